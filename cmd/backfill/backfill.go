@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jason-costello/taxcollector/scraper"
+	"github.com/jason-costello/taxcollector/storage"
+)
+
+// backfill enqueues detail pages for past tax years, which cmd/scrape then
+// works through like any other pending url.
+func main() {
+	from := flag.Int("from", scraper.FirstBackfillYear, "first tax year to enqueue")
+	to := flag.Int("to", time.Now().Year()-1, "last tax year to enqueue")
+	ids := flag.String("props", "", "comma separated property ids (default every property held)")
+	force := flag.Bool("force", false, "enqueue years that have already been scraped")
+	dsn := storage.DSNFlag(flag.CommandLine)
+	flag.Parse()
+
+	b := scraper.Backfill{From: *from, To: *to, Force: *force}
+	for _, s := range strings.Split(*ids, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid property id %q\n", s)
+			os.Exit(2)
+		}
+		b.PropertyIDs = append(b.PropertyIDs, int32(id))
+	}
+
+	db, err := storage.Open(*dsn)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	n, err := scraper.EnqueueBackfill(context.Background(), db, scraper.Config{}, b)
+	fmt.Printf("enqueued %d property years\n", n)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
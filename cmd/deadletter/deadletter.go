@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jason-costello/taxcollector/storage"
+	"github.com/jason-costello/taxcollector/storage/pgdb"
+)
+
+const usage = `usage: deadletter <command> [flags]
+
+commands:
+  list     [-match text] [-limit n]     list dead letters, newest first
+  show     -id n                        print a dead letter with its captured response
+  requeue  (-id n | -match text | -all) move dead letters back to pending_urls
+  discard  (-id n | -match text | -all) delete dead letters
+
+every command takes -dsn, the postgres connection string (default $TAXCOLLECTOR_DSN)`
+
+// deadletter inspects the jobs the scraper gave up on, and puts them back on
+// the pending queue or throws them away in bulk.
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cmd, args := os.Args[1], os.Args[2:]
+
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	id := fs.Int("id", 0, "dead letter id")
+	match := fs.String("match", "", "only dead letters whose error contains this text")
+	all := fs.Bool("all", false, "every dead letter")
+	limit := fs.Int("limit", 50, "number of dead letters to list")
+	dsn := storage.DSNFlag(fs)
+	fs.Parse(args)
+
+	db, err := storage.Open(*dsn)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	pdb := pgdb.New(db)
+	pattern := "%" + likeEscaper.Replace(*match) + "%"
+
+	switch cmd {
+	case "list":
+		err = list(ctx, pdb, pattern, *limit)
+	case "show":
+		err = show(ctx, pdb, int32(*id))
+	case "requeue", "discard":
+		if (*id != 0) == (*match != "" || *all) {
+			fmt.Fprintln(os.Stderr, usage)
+			os.Exit(2)
+		}
+		var n int64
+		n, err = apply(ctx, pdb, cmd, int32(*id), pattern)
+		fmt.Printf("%s: %d dead letters\n", cmd, n)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func list(ctx context.Context, pdb *pgdb.Queries, pattern string, limit int) error {
+	rows, err := pdb.ListDeadLetters(ctx, pgdb.ListDeadLettersParams{LastError: pattern, Limit: int32(limit)})
+	if err != nil {
+		return err
+	}
+	for _, r := range rows {
+		status := "-"
+		if r.Status.Valid {
+			status = fmt.Sprint(r.Status.Int32)
+		}
+		fmt.Printf("%d\t%s\t%s\tattempts: %d\tstatus: %s\tproxy: %s\n\t%s\n",
+			r.ID, r.FailedAt.Format(time.RFC3339), r.Url, r.Attempts, status, r.Proxy, r.LastError)
+	}
+	return nil
+}
+
+func show(ctx context.Context, pdb *pgdb.Queries, id int32) error {
+	if id == 0 {
+		return errors.New("show needs -id")
+	}
+	d, err := pdb.GetDeadLetter(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("id:          %d\n", d.ID)
+	fmt.Printf("url:         %s\n", d.Url)
+	fmt.Printf("failed at:   %s\n", d.FailedAt.Format(time.RFC3339))
+	fmt.Printf("attempts:    %d\n", d.Attempts)
+	fmt.Printf("priority:    %d\n", d.Priority)
+	if d.Status.Valid {
+		fmt.Printf("status:      %d\n", d.Status.Int32)
+	}
+	fmt.Printf("proxy:       %s\n", d.Proxy)
+	fmt.Printf("user agent:  %s\n", d.UserAgent)
+	fmt.Printf("error:       %s\n", d.LastError)
+	fmt.Printf("error chain: %s\n", d.ErrorChain)
+	fmt.Printf("headers:     %s\n", d.Headers)
+
+	truncated := ""
+	if d.BodyTruncated {
+		truncated = ", truncated"
+	}
+	fmt.Printf("body (%d bytes%s):\n%s\n", len(d.Body), truncated, strings.TrimSpace(string(d.Body)))
+	return nil
+}
+
+// likeEscaper escapes the characters ilike treats as special, so -match finds
+// the text as typed.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func apply(ctx context.Context, pdb *pgdb.Queries, cmd string, id int32, pattern string) (int64, error) {
+	switch {
+	case cmd == "requeue" && id != 0:
+		return pdb.RequeueDeadLetter(ctx, id)
+	case cmd == "requeue":
+		return pdb.RequeueDeadLetters(ctx, pattern)
+	case id != 0:
+		return pdb.DiscardDeadLetter(ctx, id)
+	default:
+		return pdb.DiscardDeadLetters(ctx, pattern)
+	}
+}
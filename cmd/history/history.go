@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jason-costello/taxcollector/storage"
+	"github.com/jason-costello/taxcollector/storage/pgdb"
+	"github.com/jason-costello/taxcollector/tax"
+)
+
+// history reads back the snapshots kept for a property: the record as it was
+// at a given time, or the list of changes between consecutive snapshots.
+func main() {
+	propID := flag.Int("prop", 0, "property id")
+	year := flag.Int("year", time.Now().Year(), "tax year")
+	asOf := flag.String("as-of", "", "print the record as of this time (2006-01-02 or RFC3339)")
+	changes := flag.Bool("changes", false, "list what changed between each snapshot")
+	dsn := storage.DSNFlag(flag.CommandLine)
+	flag.Parse()
+
+	if *propID == 0 || (*asOf == "") == !*changes {
+		fmt.Fprintln(os.Stderr, "usage: history [-dsn dsn] -prop id [-year y] (-as-of time | -changes)")
+		os.Exit(2)
+	}
+
+	db, err := storage.Open(*dsn)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	pdb := pgdb.New(db)
+
+	if *asOf != "" {
+		err = printAsOf(ctx, pdb, int32(*propID), int32(*year), *asOf)
+	} else {
+		err = printChanges(ctx, pdb, int32(*propID), int32(*year))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
+
+func printAsOf(ctx context.Context, pdb *pgdb.Queries, propID, year int32, asOf string) error {
+	at, err := parseTime(asOf)
+	if err != nil {
+		return err
+	}
+
+	snap, err := pdb.GetPropertySnapshotAsOf(ctx, pgdb.GetPropertySnapshotAsOfParams{PropertyID: propID, TaxYear: year, ValidFrom: at})
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no snapshot of property %d for %d as of %s", propID, year, at.Format(time.RFC3339))
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("snapshot %d  valid from %s\n", snap.ID, snap.ValidFrom.Format(time.RFC3339))
+	var pr tax.PropertyRecord
+	if err := json.Unmarshal(snap.Record, &pr); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(pr, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
+
+func printChanges(ctx context.Context, pdb *pgdb.Queries, propID, year int32) error {
+	snaps, err := pdb.ListPropertySnapshots(ctx, pgdb.ListPropertySnapshotsParams{PropertyID: propID, TaxYear: year})
+	if err != nil {
+		return err
+	}
+	if len(snaps) == 0 {
+		return fmt.Errorf("no snapshots of property %d for %d", propID, year)
+	}
+
+	var prev tax.PropertyRecord
+	for i, snap := range snaps {
+		var pr tax.PropertyRecord
+		if err := json.Unmarshal(snap.Record, &pr); err != nil {
+			return err
+		}
+		fmt.Printf("snapshot %d  valid from %s\n", snap.ID, snap.ValidFrom.Format(time.RFC3339))
+		if i > 0 {
+			changes, err := tax.Diff(prev, pr)
+			if err != nil {
+				return err
+			}
+			for _, c := range changes {
+				fmt.Printf("  %s: %q -> %q\n", c.Field, c.Old, c.New)
+			}
+		}
+		prev = pr
+	}
+	return nil
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jason-costello/taxcollector/proxies"
+	"github.com/jason-costello/taxcollector/storage"
+	"github.com/jason-costello/taxcollector/storage/pgdb"
+)
+
+const usage = `usage: proxies <command> [flags]
+
+commands:
+  import  [-format auto|plain|csv] [-validate] [-check-url url] [-concurrency n] file...
+          add proxies from lists, skipping ones already in the pool; - reads stdin
+  export  [-format plain|csv|json]
+          write the pool with its usage and health stats to stdout
+  summary [-since 24h]
+          per-proxy outcome counts and latencies from the event history
+  events  -proxy host:port [-limit n]
+          a proxy's recent events, newest first
+  prune   [-older-than 720h]
+          delete events older than the given age
+
+every command takes -dsn, the postgres connection string (default $TAXCOLLECTOR_DSN)`
+
+// proxies loads proxy lists from providers into the pool and writes the pool
+// back out.
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cmd, args := os.Args[1], os.Args[2:]
+
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	format := fs.String("format", "", "list format: auto, plain or csv on import; plain, csv or json on export")
+	validate := fs.Bool("validate", false, "only import proxies that pass a health check")
+	checkURL := fs.String("check-url", "", "url fetched through each proxy by -validate")
+	timeout := fs.Duration("timeout", 15*time.Second, "health check timeout per proxy")
+	concurrency := fs.Int("concurrency", 16, "number of proxies -validate checks at once")
+	since := fs.Duration("since", 24*time.Hour, "how far back summary looks")
+	proxy := fs.String("proxy", "", "proxy to list events for, as host:port")
+	limit := fs.Int("limit", 50, "number of events to list")
+	olderThan := fs.Duration("older-than", 30*24*time.Hour, "age past which prune deletes events")
+	dsn := storage.DSNFlag(fs)
+	fs.Parse(args)
+
+	db, err := storage.Open(*dsn)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	pdb := pgdb.New(db)
+
+	switch cmd {
+	case "import":
+		if fs.NArg() == 0 {
+			fmt.Fprintln(os.Stderr, usage)
+			os.Exit(2)
+		}
+		var checker *proxies.HealthChecker
+		if *validate {
+			checker = proxies.NewHealthChecker(proxies.NewProxyClient(db), proxies.HealthConfig{CheckURL: *checkURL, Timeout: *timeout, Concurrency: *concurrency})
+		}
+		err = importLists(ctx, pdb, checker, *format, fs.Args())
+	case "export":
+		err = export(ctx, pdb, os.Stdout, *format)
+	case "summary":
+		err = summary(ctx, pdb, time.Now().Add(-*since))
+	case "events":
+		if *proxy == "" {
+			fmt.Fprintln(os.Stderr, usage)
+			os.Exit(2)
+		}
+		err = events(ctx, pdb, *proxy, *limit)
+	case "prune":
+		var n int64
+		n, err = proxies.NewProxyClient(db).PruneEvents(ctx, time.Now().Add(-*olderThan))
+		fmt.Printf("prune: %d events\n", n)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func importLists(ctx context.Context, pdb *pgdb.Queries, checker *proxies.HealthChecker, format string, files []string) error {
+	f, err := proxies.ParseListFormat(format)
+	if err != nil {
+		return err
+	}
+
+	var entries []proxies.Entry
+	for _, name := range files {
+		list, err := readList(name, f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		entries = append(entries, list...)
+	}
+
+	var added, existing, failed int
+	var checks []proxies.CheckResult
+	if checker != nil {
+		ps := make([]proxies.Proxy, len(entries))
+		for i, e := range entries {
+			ps[i] = e.Proxy()
+		}
+		checks = checker.CheckAll(ctx, ps)
+	}
+	for i, e := range entries {
+		if checks != nil && checks[i].Err != nil {
+			fmt.Printf("%s\tfailed check: %s\n", e.Addr, checks[i].Err)
+			failed++
+			continue
+		}
+
+		n, err := pdb.InsertProxy(ctx, pgdb.InsertProxyParams{
+			Ip:       e.Addr,
+			Scheme:   e.Scheme,
+			Username: sql.NullString{String: e.Username, Valid: e.Username != ""},
+			Password: sql.NullString{String: e.Password, Valid: e.Username != ""},
+		})
+		if err != nil {
+			return fmt.Errorf("inserting %s: %w", e.Addr, err)
+		}
+		if n == 0 {
+			existing++
+		} else {
+			added++
+		}
+	}
+	fmt.Printf("import: %d proxies read, %d added, %d already in the pool, %d failed check\n", len(entries), added, existing, failed)
+	return nil
+}
+
+func readList(name string, f proxies.ListFormat) ([]proxies.Entry, error) {
+	if name == "-" {
+		return proxies.ParseList(os.Stdin, f)
+	}
+	if f == proxies.FormatAuto && strings.HasSuffix(strings.ToLower(name), ".csv") {
+		f = proxies.FormatCSV
+	}
+	r, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return proxies.ParseList(r, f)
+}
+
+type exported struct {
+	URL           string     `json:"url"`
+	Uses          int32      `json:"uses"`
+	LastUsedAt    *time.Time `json:"last_used_at,omitempty"`
+	Failures      int32      `json:"failures"`
+	CooldownUntil *time.Time `json:"cooldown_until,omitempty"`
+	LastCheckedAt *time.Time `json:"last_checked_at,omitempty"`
+	LatencyMs     *int32     `json:"latency_ms,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	Successes     float64    `json:"successes"`
+	Blocks        float64    `json:"blocks"`
+	Timeouts      float64    `json:"timeouts"`
+	MedianLatency *int32     `json:"median_latency_ms,omitempty"`
+	Score         float64    `json:"score"`
+}
+
+func export(ctx context.Context, pdb *pgdb.Queries, w io.Writer, format string) error {
+	rows, err := pdb.ListAllProxies(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "", "plain":
+		for _, r := range rows {
+			fmt.Fprintln(w, entry(r))
+		}
+		return nil
+	case "json":
+		enc := json.NewEncoder(w)
+		for _, r := range rows {
+			if err := enc.Encode(exportRow(r)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"scheme", "host", "port", "username", "password", "uses", "last_used_at", "failures", "cooldown_until", "last_checked_at", "latency_ms", "last_error", "successes", "blocks", "timeouts", "median_latency_ms", "score"})
+		for _, r := range rows {
+			e := entry(r)
+			host, port := e.Addr, ""
+			if i := strings.LastIndexByte(e.Addr, ':'); i >= 0 {
+				host, port = e.Addr[:i], e.Addr[i+1:]
+			}
+			x := exportRow(r)
+			cw.Write([]string{e.Scheme, host, port, e.Username, e.Password,
+				strconv.Itoa(int(x.Uses)), formatTime(x.LastUsedAt), strconv.Itoa(int(x.Failures)),
+				formatTime(x.CooldownUntil), formatTime(x.LastCheckedAt), formatInt(x.LatencyMs), x.LastError,
+				formatFloat(x.Successes), formatFloat(x.Blocks), formatFloat(x.Timeouts), formatInt(x.MedianLatency), formatFloat(x.Score)})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown export format %q: want plain, csv or json", format)
+	}
+}
+
+func summary(ctx context.Context, pdb *pgdb.Queries, since time.Time) error {
+	rows, err := pdb.SummarizeProxyEvents(ctx, since)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "proxy\tsuccess\tblocked\ttimeout\tneutral\tfailed checks\tp50 ms\tp95 ms\tlast event")
+	for _, r := range rows {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\n",
+			r.Proxy, r.Successes, r.Blocks, r.Timeouts, r.Neutral, r.FailedChecks,
+			r.MedianLatencyMs, r.P95LatencyMs, r.LastEventAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+func events(ctx context.Context, pdb *pgdb.Queries, proxy string, limit int) error {
+	rows, err := pdb.ListProxyEvents(ctx, pgdb.ListProxyEventsParams{Proxy: proxy, Limit: int32(limit)})
+	if err != nil {
+		return err
+	}
+	for _, r := range rows {
+		status, latency := "-", "-"
+		if r.Status.Valid {
+			status = fmt.Sprint(r.Status.Int32)
+		}
+		if r.LatencyMs.Valid {
+			latency = fmt.Sprintf("%dms", r.LatencyMs.Int32)
+		}
+		fmt.Printf("%s\t%s\tstatus: %s\tlatency: %s\t%s\n",
+			r.OccurredAt.Format(time.RFC3339), r.Outcome, status, latency, r.Url.String)
+	}
+	return nil
+}
+
+func entry(r pgdb.Proxy) proxies.Entry {
+	return proxies.Entry{Scheme: r.Scheme, Addr: r.Ip, Username: r.Username.String, Password: r.Password.String}
+}
+
+func exportRow(r pgdb.Proxy) exported {
+	stats := proxies.Stats{
+		Successes:     r.Successes,
+		Blocks:        r.Blocks,
+		Timeouts:      r.Timeouts,
+		MedianLatency: time.Duration(r.MedianLatencyMs.Int32) * time.Millisecond,
+	}
+	x := exported{
+		URL:       entry(r).URL().String(),
+		Uses:      r.Uses.Int32,
+		Failures:  r.Failures,
+		LastError: r.LastError.String,
+		Successes: r.Successes,
+		Blocks:    r.Blocks,
+		Timeouts:  r.Timeouts,
+		Score:     stats.Score(),
+	}
+	if r.LastUsedAt.Valid {
+		x.LastUsedAt = &r.LastUsedAt.Time
+	}
+	if r.CooldownUntil.Valid {
+		x.CooldownUntil = &r.CooldownUntil.Time
+	}
+	if r.LastCheckedAt.Valid {
+		x.LastCheckedAt = &r.LastCheckedAt.Time
+	}
+	if r.LatencyMs.Valid {
+		x.LatencyMs = &r.LatencyMs.Int32
+	}
+	if r.MedianLatencyMs.Valid {
+		x.MedianLatency = &r.MedianLatencyMs.Int32
+	}
+	return x
+}
+
+func formatInt(n *int32) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.Itoa(int(*n))
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 3, 64)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -1,53 +1,240 @@
 package main
 
 import (
+	"bufio"
 	"context"
-	"database/sql"
+	"flag"
 	"fmt"
-	"sync"
-
-	_ "github.com/lib/pq"
-
-	"github.com/jason-costello/taxcollector/storage/pgdb"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/jason-costello/taxcollector/proxies"
 	"github.com/jason-costello/taxcollector/scraper"
+	"github.com/jason-costello/taxcollector/storage"
 	"github.com/jason-costello/taxcollector/useragents"
 )
 
 func main() {
+	order := flag.String("order", "random", "order pending urls are worked in: random, oldest or priority")
+	batchSize := flag.Int("batch", 100, "number of pending urls claimed at a time")
+	claimTTL := flag.Duration("claim-ttl", time.Hour, "age after which a claimed url is considered abandoned")
+	refresh := flag.Bool("refresh", false, "keep revisiting stale properties instead of stopping once pending urls run out")
+	maxAge := flag.Duration("max-age", 30*24*time.Hour, "with -refresh, age after which a property is fetched again")
+	window := flag.Duration("window", 0, "with -refresh, time to spread a full pass over the county across (default -max-age)")
+	out := flag.String("out", "", "dry run: write records as json lines to this file (- for stdout) instead of to the database")
+	report := flag.Bool("report", false, "with -out, add each record's url and parse report to its line")
+	replay := flag.String("replay", "", "read detail pages from <propertyID>.html files in this directory instead of the site")
+	checkURL := flag.String("proxy-check-url", "", "url fetched through each proxy by the health checker (default the county landing page)")
+	checkEvery := flag.Duration("proxy-check-every", 5*time.Minute, "how often proxies are health checked; 0 turns the checker off")
+	maxLeases := flag.Int("proxy-max-leases", 1, "number of workers in this process that may use the same proxy at once; other scrapers sharing the proxies table are not counted")
+	proxyMode := flag.String("proxy-mode", "pool", "how requests go out: none (direct, held to -proxy-rate as one address), pool (through proxies) or mixed")
+	directShare := flag.Float64("direct-share", 0.5, "with -proxy-mode mixed, share of jobs sent directly rather than through a proxy")
+	syncEvery := flag.Duration("proxy-sync-every", 30*time.Second, "how often proxy usage stats are written back and the pool reloaded if the proxies table changed")
+	uaFile := flag.String("useragents", "", "file of user agents to send, one per line, each optionally followed by a tab and its share of traffic (default the built-in list)")
+	urlsFile := flag.String("urls", "", "with -out, file of urls to scrape, one per line (- for stdin); urls may also be given as arguments")
+	startRate := flag.Float64("rate", 2, "requests per second across all workers to start at")
+	minRate := flag.Float64("min-rate", 0.2, "requests per second the limiter backs off no further than")
+	maxRate := flag.Float64("max-rate", 10, "requests per second the limiter speeds up no further than")
+	proxyRate := flag.Float64("proxy-rate", 0.5, "requests per second through any one proxy, or the direct connection")
+	fetchWorkers := flag.Int("fetch-workers", 0, "number of pages fetched at once (default the number of CPUs)")
+	parseWorkers := flag.Int("parse-workers", 0, "number of pages parsed at once (default the number of CPUs)")
+	persistWorkers := flag.Int("persist-workers", 1, "number of record batches written to the database at once")
+	dsn := storage.DSNFlag(flag.CommandLine)
+	flag.Parse()
 
-	psqlInfo := fmt.Sprintf("host=%s port=%d user=%s "+
-		"password=%s dbname=%s sslmode=disable",
-		"192.168.1.100", 5432, "postgres", "postgres", "tax")
+	if *minRate <= 0 || *startRate < *minRate || *startRate > *maxRate || *proxyRate <= 0 {
+		fmt.Fprintln(os.Stderr, "-rate must lie between -min-rate and -max-rate, and every rate must be above 0")
+		os.Exit(2)
+	}
 
-	db, err := sql.Open("postgres", psqlInfo)
+	ordering, err := scraper.ParseOrdering(*order)
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
-	defer db.Close()
+	mode, err := scraper.ParseProxyMode(*proxyMode)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// A second signal kills the process instead of waiting on in-flight jobs.
+		<-ctx.Done()
+		stop()
+	}()
 
 	uac := &useragents.UserAgentClient{}
-	uac.LoadUserAgents("../../useragents.txt")
-	pc := proxies.NewProxyClient(db)
+	if *uaFile != "" {
+		if err := uac.LoadUserAgents(*uaFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
 
-	if err != nil {
-		panic(err)
+	cfg := scraper.Config{
+		BatchSize:      *batchSize,
+		RefreshMaxAge:  *maxAge,
+		RefreshWindow:  *window,
+		ProxyMaxLeases: *maxLeases,
+		ProxyMode:      mode,
+		DirectShare:    *directShare,
+		Rate:           *startRate,
+		MinRate:        *minRate,
+		MaxRate:        *maxRate,
+		ProxyRate:      *proxyRate,
+		FetchWorkers:   *fetchWorkers,
+		ParseWorkers:   *parseWorkers,
+		PersistWorkers: *persistWorkers,
+	}
+	if *replay != "" {
+		cfg.Fetcher = scraper.NewDirFetcher(*replay)
+	}
+
+	if *out != "" {
+		if name := dbOnlyFlag(); name != "" {
+			fmt.Fprintf(os.Stderr, "-%s needs the database and cannot be used with -out\n", name)
+			os.Exit(2)
+		}
+		// Progress goes to stdout, or to stderr when the records do.
+		cfg.Log = os.Stdout
+		if *out == "-" {
+			cfg.Log = os.Stderr
+		}
+		result, err := dryRun(ctx, uac, cfg, *out, *report, *urlsFile, flag.Args())
+		fmt.Fprintln(cfg.Log, result)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
 	}
-	s := scraper.NewScraper(pc, uac, db, nil)
-	pdb := pgdb.New(db)
 
-	remainingCount, err := pdb.GetRemainingURLCount(context.Background())
+	db, err := storage.Open(*dsn)
 	if err != nil {
 		panic(err)
 	}
+	defer db.Close()
+
+	var pc *proxies.ProxyClient
+	// The pool keeps syncing through the shutdown grace period and is only
+	// stopped, with a last flush, once the workers have handed back their
+	// leases.
+	poolCtx, stopPool := context.WithCancel(context.Background())
+	defer stopPool()
+	poolDone := make(chan struct{})
+	if mode != scraper.ProxyModeNone && *replay == "" {
+		pc = proxies.NewProxyClient(db)
+		if *checkEvery > 0 {
+			checker := proxies.NewHealthChecker(pc, proxies.HealthConfig{CheckURL: *checkURL, Interval: *checkEvery})
+			go checker.Run(ctx)
+		}
+		go func() {
+			pc.Run(poolCtx, *syncEvery)
+			close(poolDone)
+		}()
+	}
+
+	s := scraper.NewScraper(pc, uac, db, nil, cfg)
+	queue := scraper.NewPendingQueue(db, ordering, *claimTTL)
+
+	var result scraper.Result
+	if *refresh {
+		result = s.Refresh(ctx, queue)
+	} else {
+		result = s.Scrape(ctx, queue)
+	}
+	if pc != nil {
+		stopPool()
+		<-poolDone
+	}
+	fmt.Println(result)
+}
+
+// dbOnlyFlags are the flags that only mean something with a database and so
+// are refused in a dry run.
+var dbOnlyFlags = []string{
+	"order", "batch", "claim-ttl", "refresh", "max-age", "window", "dsn",
+	"proxy-check-url", "proxy-check-every", "proxy-max-leases", "proxy-mode", "direct-share", "proxy-sync-every",
+}
+
+// dbOnlyFlag returns the first of dbOnlyFlags given on the command line, or ""
+// when there is none.
+func dbOnlyFlag() string {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, name := range dbOnlyFlags {
+		if set[name] {
+			return name
+		}
+	}
+	return ""
+}
 
-	urls, err := pdb.GetRandomURLs(context.Background(), int32(remainingCount))
+// dryRun scrapes the given urls straight to json lines, without a database
+// and so without proxies. Progress goes to cfg.Log.
+func dryRun(ctx context.Context, uac *useragents.UserAgentClient, cfg scraper.Config, out string, report bool, urlsFile string, args []string) (scraper.Result, error) {
+	urls, err := readURLs(urlsFile, args)
 	if err != nil {
-		panic(err)
+		return scraper.Result{}, err
+	}
+	if len(urls) == 0 {
+		return scraper.Result{}, fmt.Errorf("no urls to scrape: pass -urls or urls as arguments")
+	}
+
+	var w io.Writer = os.Stdout
+	var f *os.File
+	if out != "-" {
+		if f, err = os.Create(out); err != nil {
+			return scraper.Result{}, err
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+
+	cfg.Sink = scraper.NewJSONLinesSink(bw, report)
+	s := scraper.NewScraper(nil, uac, nil, nil, cfg)
+	result := s.Scrape(ctx, scraper.NewSliceQueue(urls))
+
+	if err := bw.Flush(); err != nil {
+		return result, fmt.Errorf("writing %s: %w", out, err)
+	}
+	if f != nil {
+		if err := f.Close(); err != nil {
+			return result, fmt.Errorf("writing %s: %w", out, err)
+		}
+	}
+	return result, nil
+}
+
+func readURLs(path string, args []string) ([]string, error) {
+	urls := append([]string(nil), args...)
+	if path == "" {
+		return urls, nil
+	}
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if u := strings.TrimSpace(scanner.Text()); u != "" && !strings.HasPrefix(u, "#") {
+			urls = append(urls, u)
+		}
 	}
-	wg := new(sync.WaitGroup)
-	wg.Add(len(urls))
-	s.Scrape(urls)
-	wg.Wait()
+	return urls, scanner.Err()
 }
@@ -0,0 +1,50 @@
+package proxies
+
+import (
+	"context"
+	"time"
+
+	"github.com/jason-costello/taxcollector/storage/pgdb"
+)
+
+// maxPendingEvents bounds the events held in memory between flushes; past it
+// the oldest are dropped, so a database outage costs history rather than
+// memory.
+const maxPendingEvents = 10000
+
+// Event is one use of a proxy, kept in the proxy_events table for
+// dashboards. Status is 0 when no response came back and URL is the job the
+// proxy was leased for.
+type Event struct {
+	At      time.Time
+	Outcome Outcome
+	Status  int
+	Latency time.Duration
+	URL     string
+}
+
+type proxyEvent struct {
+	proxy string
+	event Event
+}
+
+func insertEvents(ctx context.Context, q *pgdb.Queries, events []proxyEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	var params pgdb.InsertProxyEventsParams
+	for _, e := range events {
+		params.OccurredAt = append(params.OccurredAt, e.event.At)
+		params.Proxy = append(params.Proxy, e.proxy)
+		params.Outcome = append(params.Outcome, e.event.Outcome.String())
+		params.Status = append(params.Status, int32(e.event.Status))
+		params.LatencyMs = append(params.LatencyMs, int32(e.event.Latency.Milliseconds()))
+		params.Url = append(params.Url, e.event.URL)
+	}
+	return q.InsertProxyEvents(ctx, params)
+}
+
+// PruneEvents deletes proxy events older than before.
+func (p *ProxyClient) PruneEvents(ctx context.Context, before time.Time) (int64, error) {
+	return p.pdb.PruneProxyEvents(ctx, before)
+}
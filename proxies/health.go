@@ -0,0 +1,211 @@
+package proxies
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCheckURL         = "https://propaccess.trueautomation.com/clientdb/?cid=56"
+	defaultCheckInterval    = 5 * time.Minute
+	defaultCheckTimeout     = 15 * time.Second
+	defaultCheckConcurrency = 16
+)
+
+type HealthConfig struct {
+	// CheckURL is fetched through each proxy; any 2xx or 3xx answer passes.
+	CheckURL string
+	// Interval is how often a round of checks runs, and how long a healthy
+	// proxy goes between checks.
+	Interval    time.Duration
+	Timeout     time.Duration
+	Concurrency int
+}
+
+func (c HealthConfig) withDefaults() HealthConfig {
+	if c.CheckURL == "" {
+		c.CheckURL = defaultCheckURL
+	}
+	if c.Interval <= 0 {
+		c.Interval = defaultCheckInterval
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultCheckTimeout
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = defaultCheckConcurrency
+	}
+	return c
+}
+
+type CheckResult struct {
+	// IP is the proxy's host:port.
+	IP      string
+	Latency time.Duration
+	Err     error
+}
+
+// HealthChecker probes proxies in the background. Healthy proxies are checked
+// once per interval and their latency recorded; a failed check puts a proxy
+// into a cooldown that doubles with each consecutive failure, and proxies in
+// cooldown are checked again once it runs out and re-enabled when they pass.
+type HealthChecker struct {
+	pc  *ProxyClient
+	cfg HealthConfig
+
+	mu        sync.Mutex
+	lastRound time.Duration
+}
+
+func NewHealthChecker(pc *ProxyClient, cfg HealthConfig) *HealthChecker {
+	return &HealthChecker{pc: pc, cfg: cfg.withDefaults()}
+}
+
+// Run checks proxies every interval until ctx is cancelled.
+func (h *HealthChecker) Run(ctx context.Context) {
+	t := time.NewTicker(h.cfg.Interval)
+	defer t.Stop()
+	for {
+		results, err := h.CheckOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			fmt.Printf("proxy health: %s\n", err)
+		}
+		failed := 0
+		for _, r := range results {
+			if r.Err != nil {
+				failed++
+			}
+		}
+		if len(results) > 0 {
+			fmt.Printf("proxy health: checked %d proxies, %d failed\n", len(results), failed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// checkSlack absorbs ticker and clock jitter between rounds.
+const checkSlack = time.Second
+
+// dueBefore is the last_checked_at a healthy proxy must be older than to be
+// checked in a round starting at start. Proxies are stamped as the previous
+// round finishes, up to that round's length after the tick that started it,
+// so the round's length is allowed for; otherwise they would only come due
+// every other tick.
+func (h *HealthChecker) dueBefore(start time.Time) time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return start.Add(-h.cfg.Interval + h.lastRound + checkSlack)
+}
+
+func (h *HealthChecker) roundTook(d time.Duration) {
+	h.mu.Lock()
+	h.lastRound = d
+	h.mu.Unlock()
+}
+
+// CheckOnce probes every proxy that is due a check and records the results.
+func (h *HealthChecker) CheckOnce(ctx context.Context) ([]CheckResult, error) {
+	start := time.Now()
+	defer func() { h.roundTook(time.Since(start)) }()
+
+	due := sql.NullTime{Time: h.dueBefore(start), Valid: true}
+	rows, err := h.pc.pdb.ListProxiesToCheck(ctx, due)
+	if err != nil {
+		return nil, fmt.Errorf("ListProxiesToCheck: %w", err)
+	}
+	ps := make([]Proxy, len(rows))
+	for i, r := range rows {
+		ps[i] = newProxy(r.Ip, r.Scheme, r.Username, r.Password)
+	}
+
+	results := h.CheckAll(ctx, ps)
+	events := make([]proxyEvent, len(results))
+	for i, r := range results {
+		ev := Event{At: time.Now(), Outcome: outcomeCheckPassed, Latency: r.Latency, URL: h.cfg.CheckURL}
+		if r.Err != nil {
+			ev.Outcome = outcomeCheckFailed
+			err = h.pc.coolDown(ctx, r.IP, true, r.Err)
+		} else {
+			err = h.pc.reenable(ctx, r.IP, r.Latency)
+		}
+		if err != nil {
+			return results, fmt.Errorf("recording check of %s: %w", r.IP, err)
+		}
+		events[i] = proxyEvent{proxy: r.IP, event: ev}
+	}
+	if err := insertEvents(ctx, h.pc.pdb, events); err != nil {
+		return results, fmt.Errorf("InsertProxyEvents: %w", err)
+	}
+	return results, nil
+}
+
+// CheckAll checks every proxy, Concurrency at a time, and returns the results
+// in the order of ps. Nothing is recorded.
+func (h *HealthChecker) CheckAll(ctx context.Context, ps []Proxy) []CheckResult {
+	return checkAll(ctx, ps, h.cfg.Concurrency, func(ctx context.Context, p Proxy) (time.Duration, error) {
+		return h.Check(ctx, p.URL())
+	})
+}
+
+// checkAll runs probe for every proxy, at most concurrency at a time, and
+// returns the results in the order of ps.
+func checkAll(ctx context.Context, ps []Proxy, concurrency int, probe func(context.Context, Proxy) (time.Duration, error)) []CheckResult {
+	results := make([]CheckResult, len(ps))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, p := range ps {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, p Proxy) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			latency, err := probe(ctx, p)
+			results[i] = CheckResult{IP: p.Addr(), Latency: latency, Err: err}
+		}(i, p)
+	}
+	wg.Wait()
+	return results
+}
+
+// Check fetches the check url through the proxy and times it. Nothing is
+// recorded.
+func (h *HealthChecker) Check(ctx context.Context, proxyURL *url.URL) (time.Duration, error) {
+	client := &http.Client{
+		Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)},
+		Timeout:   h.cfg.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", h.cfg.CheckURL, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	latency := time.Since(start)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 399 {
+		return latency, fmt.Errorf("check url answered %s", resp.Status)
+	}
+	return latency, nil
+}
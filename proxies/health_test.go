@@ -0,0 +1,116 @@
+package proxies
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthChecker_Check(t *testing.T) {
+	// A plain http proxy is handed absolute urls, so any server can stand in
+	// for one; this one answers for the check url itself.
+	var status int32 = http.StatusOK
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Proxy-Authorization"); auth != "" && auth != "Basic Ym9iOnMzY3JldA==" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer proxy.Close()
+
+	h := NewHealthChecker(nil, HealthConfig{CheckURL: "http://check.invalid/", Timeout: time.Second})
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	if _, err := h.Check(context.Background(), proxyURL); err != nil {
+		t.Errorf("Check() through a working proxy = %v", err)
+	}
+
+	proxyURL.User = url.UserPassword("bob", "s3cret")
+	if _, err := h.Check(context.Background(), proxyURL); err != nil {
+		t.Errorf("Check() with the right credentials = %v", err)
+	}
+	proxyURL.User = url.UserPassword("bob", "wrong")
+	if _, err := h.Check(context.Background(), proxyURL); err == nil {
+		t.Error("Check() passed a proxy that refused its credentials")
+	}
+	proxyURL.User = nil
+
+	atomic.StoreInt32(&status, http.StatusForbidden)
+	if _, err := h.Check(context.Background(), proxyURL); err == nil {
+		t.Error("Check() passed a 403")
+	}
+
+	proxy.Close()
+	if _, err := h.Check(context.Background(), proxyURL); err == nil {
+		t.Error("Check() passed a proxy that is down")
+	}
+}
+
+func Test_checkAll(t *testing.T) {
+	var running, peak int32
+	probe := func(ctx context.Context, p Proxy) (time.Duration, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if p.IP == "bad" {
+			return 0, errors.New("refused")
+		}
+		return time.Millisecond, nil
+	}
+
+	ips := []string{"a", "bad", "c", "d", "e", "f"}
+	ps := make([]Proxy, len(ips))
+	for i, ip := range ips {
+		ps[i] = Proxy{IP: ip}
+	}
+	results := checkAll(context.Background(), ps, 2, probe)
+
+	if peak > 2 {
+		t.Errorf("%d probes ran at once, want at most 2", peak)
+	}
+	for i, r := range results {
+		if r.IP != ips[i] {
+			t.Fatalf("result %d is for %s, want %s", i, r.IP, ips[i])
+		}
+		if (r.Err != nil) != (r.IP == "bad") {
+			t.Errorf("result for %s: err = %v", r.IP, r.Err)
+		}
+	}
+}
+
+func TestHealthChecker_dueBefore(t *testing.T) {
+	interval := 5 * time.Minute
+	h := NewHealthChecker(nil, HealthConfig{Interval: interval})
+
+	// The first round starts at t0, takes 40s, and stamps the proxies it
+	// checked as it finishes.
+	t0 := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	if due, want := h.dueBefore(t0), t0.Add(-interval+checkSlack); !due.Equal(want) {
+		t.Errorf("first round checks proxies last checked before %s, want %s", due, want)
+	}
+	h.roundTook(40 * time.Second)
+	checked := t0.Add(40 * time.Second)
+
+	// The next tick comes one interval after the first; the proxies must be
+	// due again then, not one tick later.
+	if due := h.dueBefore(t0.Add(interval)); !checked.Before(due) {
+		t.Errorf("proxy checked at %s is not due in the next round (due before %s)", checked, due)
+	}
+	h.roundTook(40 * time.Second)
+	checked = t0.Add(interval + 40*time.Second)
+	if due := h.dueBefore(t0.Add(interval + time.Minute)); checked.Before(due) {
+		t.Errorf("proxy checked at %s is due again a minute later (due before %s)", checked, due)
+	}
+}
@@ -0,0 +1,67 @@
+package proxies
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// leaseRetry is the longest Lease waits before looking again when every
+// proxy is leased to its limit, in case a reload has added some.
+const leaseRetry = time.Second
+
+var ErrNoProxies = errors.New("no proxies in rotation")
+
+// Lease picks a proxy from the in-memory pool, favouring ones with a good
+// recent record and low latency (see Stats.Score), and takes one of its
+// maxLeases slots. When every proxy is full Lease waits for a slot to come
+// free. The pool is loaded from the proxies table on first use and kept in
+// step with it by Run. The proxy must be handed back with Release.
+//
+// Leases are counted in memory, so maxLeases limits this process alone: two
+// scrapers sharing a proxies table may each hold a proxy maxLeases times
+// over. Nothing in the database stops them. Where the limit has to hold
+// across processes, give each scraper its own proxies table or its own share
+// of the proxies.
+func (p *ProxyClient) Lease(ctx context.Context, maxLeases int) (Proxy, error) {
+	if maxLeases <= 0 {
+		maxLeases = 1
+	}
+
+	p.pool.mu.Lock()
+	loaded := p.pool.loaded
+	p.pool.mu.Unlock()
+	if !loaded {
+		if err := p.reload(ctx); err != nil {
+			return Proxy{}, err
+		}
+	}
+
+	for {
+		proxy, ok, freed, err := p.pool.take(maxLeases, rand.Float64)
+		if err != nil || ok {
+			return proxy, err
+		}
+
+		t := time.NewTimer(leaseRetry)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return Proxy{}, ctx.Err()
+		case <-freed:
+			t.Stop()
+		case <-t.C:
+		}
+	}
+}
+
+// Release hands back a proxy taken with Lease, adding the outcome of the
+// request made through it to the proxy's stats and its event history.
+// OutcomeNone leaves the stats alone. An event with no time is stamped now.
+func (p *ProxyClient) Release(proxy Proxy, ev Event) {
+	if ev.At.IsZero() {
+		ev.At = time.Now()
+	}
+	p.pool.release(proxy, ev)
+}
@@ -0,0 +1,254 @@
+package proxies
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Entry is one proxy read from a list. Addr is host:port and is what the
+// proxies table is keyed on.
+type Entry struct {
+	Scheme   string
+	Addr     string
+	Username string
+	Password string
+}
+
+// URL is the proxy url as http.Transport and the health checker want it.
+func (e Entry) URL() *url.URL {
+	u := &url.URL{Scheme: e.Scheme, Host: e.Addr}
+	if e.Username != "" {
+		u.User = url.UserPassword(e.Username, e.Password)
+	}
+	return u
+}
+
+// Proxy is the entry as the pool would load it once imported.
+func (e Entry) Proxy() Proxy {
+	return newProxy(e.Addr, e.Scheme,
+		sql.NullString{String: e.Username, Valid: e.Username != ""},
+		sql.NullString{String: e.Password, Valid: e.Username != ""})
+}
+
+// String writes the entry back in list form, leaving out the scheme for plain
+// http proxies.
+func (e Entry) String() string {
+	if e.Scheme == "http" {
+		s := e.Addr
+		if e.Username != "" {
+			s = url.UserPassword(e.Username, e.Password).String() + "@" + s
+		}
+		return s
+	}
+	return e.URL().String()
+}
+
+type ListFormat string
+
+const (
+	FormatAuto  ListFormat = "auto"
+	FormatPlain ListFormat = "plain"
+	FormatCSV   ListFormat = "csv"
+)
+
+func ParseListFormat(s string) (ListFormat, error) {
+	switch f := ListFormat(s); f {
+	case FormatAuto, FormatPlain, FormatCSV:
+		return f, nil
+	case "":
+		return FormatAuto, nil
+	default:
+		return "", fmt.Errorf("unknown list format %q: want auto, plain or csv", s)
+	}
+}
+
+// ParseList reads a proxy list. Plain lists hold one proxy per line as
+// ip:port, ip:port:user:pass, user:pass@ip:port or scheme://[user:pass@]ip:port;
+// blank lines and lines starting with # are skipped. CSV lists hold host, port,
+// username, password and scheme columns in that order, or in any order under
+// a header row naming them. Auto treats input whose first line has a comma
+// as CSV. Entries repeated within the list are returned once.
+func ParseList(r io.Reader, format ListFormat) ([]Entry, error) {
+	br := bufio.NewReader(r)
+	if format == FormatAuto {
+		first, _ := br.Peek(4096)
+		line := string(first)
+		if i := strings.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i]
+		}
+		format = FormatPlain
+		if strings.Contains(line, ",") {
+			format = FormatCSV
+		}
+	}
+
+	var entries []Entry
+	var err error
+	if format == FormatCSV {
+		entries, err = parseCSV(br)
+	} else {
+		entries, err = parsePlain(br)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return dedupe(entries), nil
+}
+
+func parsePlain(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		e, err := ParseEntry(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// ParseEntry reads a single proxy in any of the plain list forms.
+func ParseEntry(s string) (Entry, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "://") {
+		// ip:port:user:pass is how most providers hand lists out.
+		if parts := strings.Split(s, ":"); len(parts) == 4 && !strings.Contains(s, "@") {
+			s = parts[2] + ":" + parts[3] + "@" + parts[0] + ":" + parts[1]
+		}
+		s = "http://" + s
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return Entry{}, err
+	}
+	e := Entry{Scheme: strings.ToLower(u.Scheme), Addr: u.Host}
+	if u.User != nil {
+		e.Username = u.User.Username()
+		e.Password, _ = u.User.Password()
+	}
+	return e, e.validate()
+}
+
+func parseCSV(r io.Reader) ([]Entry, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.Comment = '#'
+
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	cols := map[string]int{"host": 0, "port": 1, "username": 2, "password": 3, "scheme": 4}
+	if header, ok := csvHeader(records[0]); ok {
+		cols = header
+		records = records[1:]
+	}
+
+	field := func(rec []string, name string) string {
+		i, ok := cols[name]
+		if !ok || i >= len(rec) {
+			return ""
+		}
+		return strings.TrimSpace(rec[i])
+	}
+
+	var entries []Entry
+	for n, rec := range records {
+		host, port := field(rec, "host"), field(rec, "port")
+		addr := host
+		if port != "" {
+			addr = net.JoinHostPort(host, port)
+		}
+		e := Entry{
+			Scheme:   strings.ToLower(field(rec, "scheme")),
+			Addr:     addr,
+			Username: field(rec, "username"),
+			Password: field(rec, "password"),
+		}
+		if e.Scheme == "" {
+			e.Scheme = "http"
+		}
+		if err := e.validate(); err != nil {
+			return nil, fmt.Errorf("record %d: %w", n+1, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+var csvColumns = map[string]string{
+	"host": "host", "ip": "host", "address": "host", "proxy": "host",
+	"port":     "port",
+	"username": "username", "user": "username", "login": "username",
+	"password": "password", "pass": "password",
+	"scheme": "scheme", "protocol": "scheme", "type": "scheme",
+}
+
+// csvHeader maps column names to indexes when rec is a header row, which it
+// is taken to be when it names a host column.
+func csvHeader(rec []string) (map[string]int, bool) {
+	cols := make(map[string]int)
+	for i, name := range rec {
+		if c, ok := csvColumns[strings.ToLower(strings.TrimSpace(name))]; ok {
+			cols[c] = i
+		}
+	}
+	_, ok := cols["host"]
+	return cols, ok
+}
+
+func (e Entry) validate() error {
+	switch e.Scheme {
+	case "http", "https", "socks5":
+	case "socks5h":
+		// net/http only dials socks5h from go 1.22. Its socks5 already hands
+		// host names to the proxy to resolve, which is what socks5h asks for.
+		return fmt.Errorf("unsupported proxy scheme %q: use socks5, which resolves names on the proxy", e.Scheme)
+	default:
+		return fmt.Errorf("unsupported proxy scheme %q", e.Scheme)
+	}
+	host, port, err := net.SplitHostPort(e.Addr)
+	if err != nil {
+		return fmt.Errorf("proxy address %q: %w", e.Addr, err)
+	}
+	if host == "" {
+		return fmt.Errorf("proxy address %q has no host", e.Addr)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return fmt.Errorf("proxy address %q has an invalid port", e.Addr)
+	}
+	return nil
+}
+
+func dedupe(entries []Entry) []Entry {
+	seen := make(map[string]bool)
+	out := entries[:0]
+	for _, e := range entries {
+		if seen[e.Addr] {
+			continue
+		}
+		seen[e.Addr] = true
+		out = append(out, e)
+	}
+	return out
+}
@@ -0,0 +1,326 @@
+package proxies
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jason-costello/taxcollector/storage/pgdb"
+)
+
+// pool is the in-memory copy of the proxies in rotation that leases are
+// taken from. Usage stats are gathered here and written back by Flush.
+type pool struct {
+	mu      sync.Mutex
+	loaded  bool
+	version int64
+	entries map[string]*poolEntry
+	// list holds the entries in the order they were loaded, so picks do not
+	// depend on map order.
+	list []*poolEntry
+	// freed is closed and replaced whenever a lease is released, waking
+	// any Lease waiting on a full pool.
+	freed chan struct{}
+	// events are the releases not yet written to proxy_events.
+	events []proxyEvent
+}
+
+type poolEntry struct {
+	proxy     Proxy
+	stats     Stats
+	latencies []int32
+	leases    int
+	// out is set when the proxy has been taken out of rotation since the
+	// pool was loaded; it stays until the next reload drops it.
+	out   bool
+	dirty bool
+}
+
+func newPool() *pool {
+	return &pool{entries: make(map[string]*poolEntry), freed: make(chan struct{})}
+}
+
+// load replaces the pool with the proxies in rows. Proxies already in the pool
+// keep their in-memory stats and leases, which are never older than the
+// table's. Proxies gone from rows are dropped, unless they are still leased or
+// have stats to flush, in which case they stay out of rotation until they
+// have neither.
+func (pl *pool) load(rows []pgdb.ListSelectableProxiesRow, version int64) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	entries := make(map[string]*poolEntry, len(rows))
+	var list []*poolEntry
+	for _, r := range rows {
+		p := newProxy(r.Ip, r.Scheme, r.Username, r.Password)
+		if e, ok := pl.entries[p.Addr()]; ok {
+			p.Uses, p.LastUsed = e.proxy.Uses, e.proxy.LastUsed
+			e.proxy, e.out = p, false
+			entries[p.Addr()] = e
+			list = append(list, e)
+			continue
+		}
+		p.Uses = int(r.Uses.Int32)
+		p.LastUsed = r.LastUsedAt.Time
+		e := &poolEntry{
+			proxy: p,
+			stats: Stats{
+				Successes:     r.Successes,
+				Blocks:        r.Blocks,
+				Timeouts:      r.Timeouts,
+				MedianLatency: time.Duration(r.MedianLatencyMs.Int32) * time.Millisecond,
+			},
+			latencies: r.LatenciesMs,
+		}
+		entries[p.Addr()] = e
+		list = append(list, e)
+	}
+	for _, e := range pl.list {
+		addr := e.proxy.Addr()
+		if _, ok := entries[addr]; !ok && (e.leases > 0 || e.dirty) {
+			e.out = true
+			entries[addr] = e
+			list = append(list, e)
+		}
+	}
+
+	pl.entries = entries
+	pl.list = list
+	pl.version = version
+	pl.loaded = true
+}
+
+// take leases a proxy with a free slot, or reports false with the channel to
+// wait on for one. It fails with ErrNoProxies when nothing is in rotation.
+func (pl *pool) take(maxLeases int, random func() float64) (Proxy, bool, <-chan struct{}, error) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	var cands []candidate
+	inRotation := 0
+	for _, e := range pl.list {
+		if e.out {
+			continue
+		}
+		inRotation++
+		if e.leases < maxLeases {
+			cands = append(cands, candidate{proxy: e.proxy, stats: e.stats})
+		}
+	}
+	if inRotation == 0 {
+		return Proxy{}, false, nil, ErrNoProxies
+	}
+	if len(cands) == 0 {
+		return Proxy{}, false, pl.freed, nil
+	}
+
+	e := pl.entries[pick(cands, random).Addr()]
+	e.leases++
+	e.proxy.Uses++
+	e.proxy.LastUsed = time.Now()
+	e.dirty = true
+	return e.proxy, true, nil, nil
+}
+
+func (pl *pool) release(proxy Proxy, ev Event) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	if e, ok := pl.entries[proxy.Addr()]; ok {
+		if ev.Outcome != OutcomeNone {
+			e.latencies = e.stats.add(ev.Outcome, ev.Latency, e.latencies)
+			e.dirty = true
+		}
+		if e.leases > 0 {
+			e.leases--
+		}
+	}
+	pl.addEvents(proxyEvent{proxy: proxy.Addr(), event: ev})
+
+	close(pl.freed)
+	pl.freed = make(chan struct{})
+}
+
+// addEvents queues events for the next flush. pl.mu must be held.
+func (pl *pool) addEvents(events ...proxyEvent) {
+	pl.events = append(pl.events, events...)
+	if over := len(pl.events) - maxPendingEvents; over > 0 {
+		pl.events = append(pl.events[:0], pl.events[over:]...)
+	}
+}
+
+// takeEvents returns the queued events and clears the queue.
+func (pl *pool) takeEvents() []proxyEvent {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	events := pl.events
+	pl.events = nil
+	return events
+}
+
+// putEventsBack queues events that failed to write ahead of any that came in
+// since.
+func (pl *pool) putEventsBack(events []proxyEvent) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	queued := pl.events
+	pl.events = nil
+	pl.addEvents(append(events, queued...)...)
+}
+
+// takeOut stops the proxy being leased until a reload finds it back in
+// rotation.
+func (pl *pool) takeOut(addr string) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if e, ok := pl.entries[addr]; ok {
+		e.out = true
+	}
+}
+
+// dirty returns the stats of every proxy that has changed since the last
+// call, marking them clean.
+func (pl *pool) dirty() []pgdb.SaveProxyStatsParams {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	var params []pgdb.SaveProxyStatsParams
+	for _, e := range pl.list {
+		if !e.dirty {
+			continue
+		}
+		e.dirty = false
+		sp := pgdb.SaveProxyStatsParams{
+			Ip:          e.proxy.Addr(),
+			Uses:        sql.NullInt32{Int32: int32(e.proxy.Uses), Valid: true},
+			Successes:   e.stats.Successes,
+			Blocks:      e.stats.Blocks,
+			Timeouts:    e.stats.Timeouts,
+			LatenciesMs: append([]int32{}, e.latencies...),
+		}
+		if !e.proxy.LastUsed.IsZero() {
+			sp.LastUsedAt = sql.NullTime{Time: e.proxy.LastUsed, Valid: true}
+		}
+		if e.stats.MedianLatency > 0 {
+			sp.MedianLatencyMs = sql.NullInt32{Int32: int32(e.stats.MedianLatency.Milliseconds()), Valid: true}
+		}
+		params = append(params, sp)
+	}
+	return params
+}
+
+func (pl *pool) markDirty(params []pgdb.SaveProxyStatsParams) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	for _, sp := range params {
+		if e, ok := pl.entries[sp.Ip]; ok {
+			e.dirty = true
+		}
+	}
+}
+
+// Run keeps the pool in step with the proxies table until ctx is cancelled,
+// then flushes it one last time. Cancel ctx once the workers holding leases
+// have stopped, and wait for Run to return, so the last flush catches their
+// stats before the process exits.
+func (p *ProxyClient) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			fctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := p.Flush(fctx); err != nil {
+				fmt.Printf("proxy pool: %s\n", err)
+			}
+			cancel()
+			return
+		case <-t.C:
+		}
+		if err := p.Sync(ctx); err != nil && ctx.Err() == nil {
+			fmt.Printf("proxy pool: %s\n", err)
+		}
+	}
+}
+
+// Sync flushes the pool's stats and reloads it if the proxies in rotation
+// have changed since it was loaded.
+func (p *ProxyClient) Sync(ctx context.Context) error {
+	if err := p.Flush(ctx); err != nil {
+		return err
+	}
+	version, err := p.pdb.GetProxyPoolVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("GetProxyPoolVersion: %w", err)
+	}
+	p.pool.mu.Lock()
+	current := p.pool.loaded && p.pool.version == version
+	p.pool.mu.Unlock()
+	if current {
+		return nil
+	}
+	return p.reload(ctx)
+}
+
+func (p *ProxyClient) reload(ctx context.Context) error {
+	// The version is read first so a change made while the rows are read
+	// is picked up by the next Sync.
+	version, err := p.pdb.GetProxyPoolVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("GetProxyPoolVersion: %w", err)
+	}
+	rows, err := p.pdb.ListSelectableProxies(ctx)
+	if err != nil {
+		return fmt.Errorf("ListSelectableProxies: %w", err)
+	}
+	p.pool.load(rows, version)
+	return nil
+}
+
+// Flush writes the usage stats and events gathered since the last flush to
+// the database in one transaction. What fails to write is kept for the next
+// flush. Calls run one at a time, so Flush never returns while an earlier
+// call is still writing.
+func (p *ProxyClient) Flush(ctx context.Context) error {
+	p.flushMu.Lock()
+	defer p.flushMu.Unlock()
+
+	params := p.pool.dirty()
+	events := p.pool.takeEvents()
+	if len(params) == 0 && len(events) == 0 {
+		return nil
+	}
+
+	err := p.save(ctx, params, events)
+	if err != nil {
+		p.pool.markDirty(params)
+		p.pool.putEventsBack(events)
+		return fmt.Errorf("saving stats for %d proxies and %d events: %w", len(params), len(events), err)
+	}
+	return nil
+}
+
+func (p *ProxyClient) save(ctx context.Context, params []pgdb.SaveProxyStatsParams, events []proxyEvent) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	q := p.pdb.WithTx(tx)
+	for _, sp := range params {
+		if err := q.SaveProxyStats(ctx, sp); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := insertEvents(ctx, q, events); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package proxies
+
+import (
+	"database/sql"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/jason-costello/taxcollector/storage/pgdb"
+)
+
+func poolRows(addrs ...string) []pgdb.ListSelectableProxiesRow {
+	rows := make([]pgdb.ListSelectableProxiesRow, len(addrs))
+	for i, addr := range addrs {
+		rows[i] = pgdb.ListSelectableProxiesRow{Ip: addr, Scheme: "http", Uses: sql.NullInt32{Int32: 7, Valid: true}}
+	}
+	return rows
+}
+
+func Test_pool_take(t *testing.T) {
+	pl := newPool()
+	pl.load(poolRows("10.0.0.1:8080", "10.0.0.2:8080"), 1)
+	rnd := rand.New(rand.NewSource(1)).Float64
+
+	var leased []Proxy
+	for i := 0; i < 4; i++ {
+		p, ok, _, err := pl.take(2, rnd)
+		if err != nil || !ok {
+			t.Fatalf("take %d: ok %t err %v", i, ok, err)
+		}
+		leased = append(leased, p)
+	}
+	_, ok, freed, err := pl.take(2, rnd)
+	if ok || err != nil || freed == nil {
+		t.Fatalf("take on a full pool: ok %t err %v", ok, err)
+	}
+
+	pl.release(leased[0], Event{Outcome: OutcomeSuccess, Latency: 300 * time.Millisecond})
+	select {
+	case <-freed:
+	default:
+		t.Error("release did not wake waiters")
+	}
+	if p, ok, _, _ := pl.take(2, rnd); !ok || p.Addr() != leased[0].Addr() {
+		t.Errorf("take after release = %s %t, want %s", p.Addr(), ok, leased[0].Addr())
+	}
+
+	pl.takeOut("10.0.0.1:8080")
+	pl.takeOut("10.0.0.2:8080")
+	if _, _, _, err := pl.take(2, rnd); err != ErrNoProxies {
+		t.Errorf("take with every proxy out = %v, want ErrNoProxies", err)
+	}
+}
+
+func Test_pool_load(t *testing.T) {
+	pl := newPool()
+	pl.load(poolRows("10.0.0.1:8080", "10.0.0.2:8080", "10.0.0.3:8080"), 1)
+
+	// With exploration the second random number picks uniformly: 0.5 is
+	// the second proxy, 0.9 the third.
+	pickNext := func(n float64) func() float64 {
+		calls := 0
+		return func() float64 {
+			calls++
+			if calls == 1 {
+				return 0
+			}
+			return n
+		}
+	}
+	used, _, _, _ := pl.take(1, pickNext(0.5))
+	pl.release(used, Event{Outcome: OutcomeBlocked, Status: 403})
+	held, _, _, _ := pl.take(1, pickNext(0.9))
+	if used.Addr() != "10.0.0.2:8080" || held.Addr() != "10.0.0.3:8080" || used.Uses != 8 {
+		t.Fatalf("took %s (%d uses) and %s", used.Addr(), used.Uses, held.Addr())
+	}
+
+	stats := pl.dirty()
+	if len(stats) != 2 || stats[0].Ip != used.Addr() || stats[0].Blocks != 1 || stats[0].Uses.Int32 != 8 {
+		t.Fatalf("dirty() = %+v", stats)
+	}
+	if len(pl.dirty()) != 0 {
+		t.Error("dirty() did not mark proxies clean")
+	}
+	events := pl.takeEvents()
+	if len(events) != 1 || events[0].proxy != used.Addr() || events[0].event.Status != 403 {
+		t.Errorf("takeEvents() = %+v", events)
+	}
+
+	// The table now has the first two proxies, the first with credentials.
+	rows := poolRows("10.0.0.1:8080", "10.0.0.2:8080")
+	rows[0].Username = sql.NullString{String: "bob", Valid: true}
+	pl.load(rows, 2)
+
+	if e := pl.entries["10.0.0.1:8080"]; e == nil || e.proxy.Username != "bob" {
+		t.Errorf("reloaded proxy: %+v", e)
+	}
+	if e := pl.entries[used.Addr()]; e == nil || e.stats.Blocks != 1 || e.proxy.Uses != 8 {
+		t.Errorf("reload lost in-memory stats: %+v", e)
+	}
+	if e := pl.entries[held.Addr()]; e == nil || !e.out {
+		t.Errorf("leased proxy gone from the table should stay out of rotation, got %+v", e)
+	}
+
+	pl.release(held, Event{})
+	pl.load(rows, 3)
+	if _, ok := pl.entries[held.Addr()]; ok {
+		t.Error("released proxy gone from the table was not dropped")
+	}
+}
+
+func Test_pool_events(t *testing.T) {
+	pl := newPool()
+	for i := 0; i < maxPendingEvents+10; i++ {
+		pl.release(Proxy{IP: "10.0.0.1", Port: 8080}, Event{Status: i})
+	}
+	events := pl.takeEvents()
+	if len(events) != maxPendingEvents || events[0].event.Status != 10 {
+		t.Fatalf("%d events queued starting at %d, want %d starting at 10", len(events), events[0].event.Status, maxPendingEvents)
+	}
+
+	pl.release(Proxy{IP: "10.0.0.1", Port: 8080}, Event{Status: -1})
+	pl.putEventsBack(events[:2])
+	events = pl.takeEvents()
+	if len(events) != 3 || events[0].event.Status != 10 || events[2].event.Status != -1 {
+		t.Errorf("after putEventsBack: %+v", events)
+	}
+}
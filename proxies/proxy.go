@@ -3,8 +3,11 @@ package proxies
 import (
 	"context"
 	"database/sql"
-	"errors"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -12,84 +15,102 @@ import (
 	"github.com/jason-costello/taxcollector/storage/pgdb"
 )
 
+const (
+	cooldownBase = time.Minute
+	cooldownMax  = 6 * time.Hour
+)
+
 type ProxyClient struct {
-	hc  *http.Client
-	pdb *pgdb.Queries
-	db  *sql.DB
+	hc   *http.Client
+	pdb  *pgdb.Queries
+	db   *sql.DB
+	pool *pool
+	// flushMu serialises Flush, so that a call returns only once whatever
+	// an earlier call took from the pool has been written.
+	flushMu sync.Mutex
 }
 
 func NewProxyClient(db *sql.DB) *ProxyClient {
 	return &ProxyClient{
-		db:  db,
-		pdb: pgdb.New(db),
+		db:   db,
+		pdb:  pgdb.New(db),
+		pool: newPool(),
 	}
 
 }
 
+// Proxy is one exit from the pool. Scheme is http, https or socks5;
+// credentials, when set, go to the proxy with each connection.
 type Proxy struct {
 	IP       string    `json:"IP"`
+	Port     int       `json:"port,omitempty"`
+	Scheme   string    `json:"scheme,omitempty"`
+	Username string    `json:"-"`
+	Password string    `json:"-"`
 	LastUsed time.Time `json:"lastUsed"`
 	Uses     int       `json:"uses"`
 	IsBad    bool      `json:"is_bad"`
 }
 
-func (p *ProxyClient) GetNext() (Proxy, error) {
-	proxyRow, err := p.pdb.GetValidProxy(context.Background())
-	if err != nil {
-		return Proxy{}, err
+// newProxy builds a Proxy from a row of the proxies table, whose ip column
+// holds host:port.
+func newProxy(addr, scheme string, username, password sql.NullString) Proxy {
+	p := Proxy{IP: addr, Scheme: scheme, Username: username.String, Password: password.String}
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		if n, err := strconv.Atoi(port); err == nil {
+			p.IP, p.Port = host, n
+		}
 	}
-
-	if proxyRow.Ip == "" {
-		return Proxy{}, errors.New("no proxy ip found")
-	}
-
-	var uses int32 = 0
-	if proxyRow.Uses.Valid {
-		uses = proxyRow.Uses.Int32
-	}
-
-	proxy := Proxy{
-		IP:   proxyRow.Ip,
-		Uses: int(uses),
-	}
-
-	if err := p.UpdateLastUsed(&proxy); err != nil {
-		return Proxy{}, err
-	}
-
-	return proxy, nil
-
+	return p
 }
 
-func (p *ProxyClient) UpdateLastUsed(proxy *Proxy) error {
-	if proxy.IP == "" {
-		return errors.New("no IP provided")
+// Addr is host:port, which is what the proxies table is keyed on.
+func (p Proxy) Addr() string {
+	if p.Port == 0 {
+		return p.IP
 	}
+	return net.JoinHostPort(p.IP, strconv.Itoa(p.Port))
+}
 
-	params := pgdb.UpdateProxyLastUsedTimeParams{
-		Lastused: sql.NullString{String: time.Now().String(), Valid: true},
-		Uses:     sql.NullInt32{Int32: int32(proxy.Uses + 1), Valid: true},
-		Ip:       proxy.IP,
+// URL is the proxy as http.Transport wants it, with any credentials as user
+// info. net/http sends them as Proxy-Authorization to http and https proxies,
+// including on the CONNECT for https targets, and as the username/password
+// method to socks5 ones.
+func (p Proxy) URL() *url.URL {
+	u := &url.URL{Scheme: p.Scheme, Host: p.Addr()}
+	if u.Scheme == "" {
+		u.Scheme = "http"
 	}
-	if err := p.pdb.UpdateProxyLastUsedTime(context.Background(), params); err != nil {
-		return err
+	if p.Username != "" {
+		u.User = url.UserPassword(p.Username, p.Password)
 	}
+	return u
+}
 
-	return nil
-
+// MarkProxyAsBad takes the proxy out of rotation for a cooldown that doubles
+// with each consecutive failure, up to cooldownMax. The health checker puts it
+// back once it passes a check after the cooldown.
+func (p *ProxyClient) MarkProxyAsBad(ctx context.Context, proxyIP string) error {
+	p.pool.takeOut(proxyIP)
+	return p.coolDown(ctx, proxyIP, false, nil)
 }
 
-func (p *ProxyClient) MarkProxyAsBad(proxyIP string) error {
-	updateQuery := `update proxies set is_bad = true where ip = ?`
-	updateStmt, err := p.db.Prepare(updateQuery)
-	if err != nil {
-		return err
+func (p *ProxyClient) coolDown(ctx context.Context, proxyIP string, checked bool, cause error) error {
+	params := pgdb.CoolDownProxyParams{
+		BaseSeconds: cooldownBase.Seconds(),
+		MaxSeconds:  cooldownMax.Seconds(),
+		Checked:     checked,
+		Ip:          proxyIP,
 	}
-
-	_, err = updateStmt.Exec(proxyIP)
-	if err != nil {
-		return err
+	if cause != nil {
+		params.LastError = sql.NullString{String: cause.Error(), Valid: true}
 	}
-	return nil
+	return p.pdb.CoolDownProxy(ctx, params)
+}
 
+func (p *ProxyClient) reenable(ctx context.Context, proxyIP string, latency time.Duration) error {
+	return p.pdb.ReenableProxy(ctx, pgdb.ReenableProxyParams{
+		Ip:        proxyIP,
+		LatencyMs: sql.NullInt32{Int32: int32(latency.Milliseconds()), Valid: true},
+	})
 }
@@ -0,0 +1,134 @@
+package proxies
+
+import (
+	"sort"
+	"time"
+)
+
+type Outcome int
+
+const (
+	// OutcomeNone is a request that says nothing about the proxy, like one
+	// that lost its session or hit a server error.
+	OutcomeNone Outcome = iota
+	OutcomeSuccess
+	OutcomeBlocked
+	OutcomeTimeout
+	// Health check results are kept in the event history alongside
+	// request outcomes but never feed the stats.
+	outcomeCheckPassed
+	outcomeCheckFailed
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeSuccess:
+		return "success"
+	case OutcomeBlocked:
+		return "blocked"
+	case OutcomeTimeout:
+		return "timeout"
+	case outcomeCheckPassed:
+		return "check_passed"
+	case outcomeCheckFailed:
+		return "check_failed"
+	default:
+		return "neutral"
+	}
+}
+
+const (
+	// statsDecay is applied to a proxy's outcome counts on every request it
+	// makes, which weights roughly its last 20 requests.
+	statsDecay = 0.95
+	// latencySamples is how many successful request times the median is
+	// taken over.
+	latencySamples = 20
+	// referenceLatency is the median latency that halves a proxy's score, and
+	// what a proxy with no successful requests yet is assumed to have.
+	referenceLatency = 2 * time.Second
+	// exploreRate is the share of picks made uniformly at random, so proxies
+	// with a poor record get the odd chance to improve it.
+	exploreRate = 0.1
+)
+
+// Stats is a proxy's recent record.
+type Stats struct {
+	Successes     float64
+	Blocks        float64
+	Timeouts      float64
+	MedianLatency time.Duration
+}
+
+// Score is how strongly a proxy is favoured when picking one. It is the
+// squared success rate, smoothed so a proxy with no record starts at 0.5,
+// scaled down as the median latency grows.
+func (s Stats) Score() float64 {
+	rate := (s.Successes + 1) / (s.Successes + s.Blocks + s.Timeouts + 2)
+	latency := s.MedianLatency
+	if latency <= 0 {
+		latency = referenceLatency
+	}
+	return rate * rate / (1 + latency.Seconds()/referenceLatency.Seconds())
+}
+
+// add folds the outcome of one request into s. The counts decay first, so
+// they describe the proxy's recent record; latencies are the last few
+// successful request times in milliseconds, oldest first, and are returned
+// with this one added.
+func (s *Stats) add(o Outcome, latency time.Duration, latencies []int32) []int32 {
+	s.Successes *= statsDecay
+	s.Blocks *= statsDecay
+	s.Timeouts *= statsDecay
+	switch o {
+	case OutcomeSuccess:
+		s.Successes++
+		latencies = append(latencies, int32(latency.Milliseconds()))
+		if len(latencies) > latencySamples {
+			latencies = latencies[len(latencies)-latencySamples:]
+		}
+		s.MedianLatency = median(latencies)
+	case OutcomeBlocked:
+		s.Blocks++
+	case OutcomeTimeout:
+		s.Timeouts++
+	}
+	return latencies
+}
+
+// median is the lower median of latencies, as Postgres' percentile_disc(0.5)
+// has it.
+func median(latencies []int32) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	sorted := append([]int32(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return time.Duration(sorted[(len(sorted)-1)/2]) * time.Millisecond
+}
+
+type candidate struct {
+	proxy Proxy
+	stats Stats
+}
+
+// pick chooses a candidate at random in proportion to its score, or, one time
+// in 1/exploreRate, uniformly. random returns a number in [0, 1).
+func pick(cands []candidate, random func() float64) Proxy {
+	if random() < exploreRate {
+		return cands[int(random()*float64(len(cands)))].proxy
+	}
+
+	var total float64
+	for _, c := range cands {
+		total += c.stats.Score()
+	}
+	r := random() * total
+	for _, c := range cands {
+		r -= c.stats.Score()
+		if r < 0 {
+			return c.proxy
+		}
+	}
+	return cands[len(cands)-1].proxy
+}
@@ -0,0 +1,65 @@
+package proxies
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestStats_Score(t *testing.T) {
+	fresh := Stats{}
+	good := Stats{Successes: 18, Blocks: 1, MedianLatency: 800 * time.Millisecond}
+	slow := Stats{Successes: 18, Blocks: 1, MedianLatency: 8 * time.Second}
+	blocked := Stats{Successes: 2, Blocks: 10, Timeouts: 5, MedianLatency: 800 * time.Millisecond}
+
+	if !(good.Score() > fresh.Score() && fresh.Score() > blocked.Score()) {
+		t.Errorf("scores good %.3f fresh %.3f blocked %.3f, want them in that order", good.Score(), fresh.Score(), blocked.Score())
+	}
+	if slow.Score() >= good.Score() {
+		t.Errorf("slow proxy scored %.3f, not below fast one at %.3f", slow.Score(), good.Score())
+	}
+}
+
+func Test_pick(t *testing.T) {
+	cands := []candidate{
+		{proxy: Proxy{IP: "good"}, stats: Stats{Successes: 19, MedianLatency: 500 * time.Millisecond}},
+		{proxy: Proxy{IP: "fresh"}},
+		{proxy: Proxy{IP: "blocked"}, stats: Stats{Successes: 1, Blocks: 19, MedianLatency: 500 * time.Millisecond}},
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	counts := make(map[string]int)
+	const n = 10000
+	for i := 0; i < n; i++ {
+		counts[pick(cands, rnd.Float64).IP]++
+	}
+
+	if !(counts["good"] > counts["fresh"] && counts["fresh"] > counts["blocked"]) {
+		t.Errorf("picks %v, want good > fresh > blocked", counts)
+	}
+	// Exploration alone gives the blocked proxy about exploreRate/3 of picks.
+	if min := n * exploreRate / 3 * 0.8; float64(counts["blocked"]) < min {
+		t.Errorf("blocked proxy picked %d times, want at least %.0f from exploration", counts["blocked"], min)
+	}
+}
+
+func TestStats_add(t *testing.T) {
+	var s Stats
+	var latencies []int32
+	for i := 1; i <= latencySamples+5; i++ {
+		latencies = s.add(OutcomeSuccess, time.Duration(i)*100*time.Millisecond, latencies)
+	}
+	if len(latencies) != latencySamples || latencies[0] != 600 {
+		t.Errorf("kept latencies %v, want the last %d", latencies, latencySamples)
+	}
+	// The last 20 are 600ms to 2.5s; the lower median is the 10th, 1.5s.
+	if s.MedianLatency != 1500*time.Millisecond {
+		t.Errorf("median latency %s, want 1.5s", s.MedianLatency)
+	}
+
+	before := s.Successes
+	latencies = s.add(OutcomeBlocked, 0, latencies)
+	if s.Blocks != 1 || s.Successes != before*statsDecay || len(latencies) != latencySamples {
+		t.Errorf("after a block: %+v with %d latencies", s, len(latencies))
+	}
+}
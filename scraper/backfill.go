@@ -0,0 +1,87 @@
+package scraper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jason-costello/taxcollector/storage/pgdb"
+)
+
+const (
+	// backfillPriority ranks backfills below new urls and refreshes when
+	// pending urls are worked in priority order.
+	backfillPriority  = -2
+	backfillPageSize  = 1000
+	FirstBackfillYear = 2008
+)
+
+// Backfill describes the (property, year) pairs to enqueue. An empty
+// PropertyIDs means every property we hold. Years we already have a snapshot
+// for are skipped unless Force is set.
+type Backfill struct {
+	From        int
+	To          int
+	PropertyIDs []int32
+	Force       bool
+}
+
+// EnqueueBackfill adds a pending url for each property and tax year in b that
+// asks the detail page for that year, and returns how many it added.
+func EnqueueBackfill(ctx context.Context, db *sql.DB, cfg Config, b Backfill) (int, error) {
+	cfg = cfg.withDefaults()
+	if b.From > b.To {
+		return 0, fmt.Errorf("backfill: from year %d is after to year %d", b.From, b.To)
+	}
+	pdb := pgdb.New(db)
+
+	if len(b.PropertyIDs) > 0 {
+		return enqueueBackfillYears(ctx, pdb, cfg, b, b.PropertyIDs)
+	}
+
+	total := 0
+	var after int32
+	for {
+		ids, err := pdb.ListPropertyIDsAfter(ctx, pgdb.ListPropertyIDsAfterParams{ID: after, Limit: backfillPageSize})
+		if err != nil {
+			return total, fmt.Errorf("ListPropertyIDsAfter: %w", err)
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+		n, err := enqueueBackfillYears(ctx, pdb, cfg, b, ids)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		after = ids[len(ids)-1]
+	}
+}
+
+func enqueueBackfillYears(ctx context.Context, pdb *pgdb.Queries, cfg Config, b Backfill, ids []int32) (int, error) {
+	n := 0
+	for _, id := range ids {
+		held := make(map[int]bool)
+		if !b.Force {
+			years, err := pdb.ListPropertySnapshotYears(ctx, id)
+			if err != nil {
+				return n, fmt.Errorf("ListPropertySnapshotYears: %w", err)
+			}
+			for _, y := range years {
+				held[int(y)] = true
+			}
+		}
+
+		for year := b.From; year <= b.To; year++ {
+			if held[year] {
+				continue
+			}
+			params := pgdb.EnqueuePendingURLParams{Url: cfg.detailYearURL(id, year), Priority: backfillPriority}
+			if err := pdb.EnqueuePendingURL(ctx, params); err != nil {
+				return n, fmt.Errorf("EnqueuePendingURL: %w", err)
+			}
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,143 @@
+package scraper
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+type PageKind int
+
+const (
+	PageUnknown PageKind = iota
+	PageDetail
+	PageRateLimited
+	PageCaptcha
+	PageBlocked
+	PageServerError
+	PageSearch
+)
+
+func (k PageKind) String() string {
+	switch k {
+	case PageDetail:
+		return "detail"
+	case PageRateLimited:
+		return "rate-limit"
+	case PageCaptcha:
+		return "captcha"
+	case PageBlocked:
+		return "blocked"
+	case PageServerError:
+		return "server-error"
+	case PageSearch:
+		return "search"
+	default:
+		return "unknown"
+	}
+}
+
+// ProxyAtFault reports whether the page means the site has taken exception to
+// the proxy the request went out on, rather than to the session or itself.
+func (k PageKind) ProxyAtFault() bool {
+	return k == PageRateLimited || k == PageCaptcha || k == PageBlocked
+}
+
+type UnexpectedPageError struct {
+	Kind   PageKind
+	Status int
+	Title  string
+}
+
+func (e *UnexpectedPageError) Error() string {
+	return fmt.Sprintf("unexpected %s page: status %d title %q", e.Kind, e.Status, e.Title)
+}
+
+var (
+	rateLimitMarkers = []string{
+		"too many requests",
+		"rate limit",
+		"request limit",
+		"temporarily blocked",
+		"slow down",
+	}
+	captchaMarkers = []string{
+		"captcha",
+		"g-recaptcha",
+		"h-captcha",
+		"cf-challenge",
+		"are you a robot",
+		"verify you are human",
+	}
+	blockedMarkers = []string{
+		"access denied",
+		"request rejected",
+		"forbidden",
+		"unusual traffic",
+	}
+	serverErrorMarkers = []string{
+		"server error in '/' application",
+		"runtime error",
+		"an application error occurred",
+		"service unavailable",
+		"the resource cannot be found",
+	}
+	searchMarkers = []string{
+		"property search",
+		"searchresults.aspx",
+		"propertysearch.aspx",
+	}
+)
+
+// classifyPage decides what kind of page a detail request actually returned.
+// The site answers most failures with a 200, so the status code alone is not
+// enough and the body is checked for the property details block and for the
+// title and text of the pages it serves instead.
+func classifyPage(status int, body []byte) (PageKind, string) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return PageUnknown, ""
+	}
+	title := strings.TrimSpace(doc.Find("title").First().Text())
+
+	switch {
+	case status == http.StatusTooManyRequests:
+		return PageRateLimited, title
+	case status == http.StatusForbidden:
+		return PageBlocked, title
+	case status >= 500:
+		return PageServerError, title
+	}
+
+	if status >= 200 && status < 300 && doc.Find("#propertyDetails").Length() > 0 {
+		return PageDetail, title
+	}
+
+	text := strings.ToLower(title + " " + string(body))
+	switch {
+	case containsAny(text, captchaMarkers):
+		return PageCaptcha, title
+	case containsAny(text, rateLimitMarkers):
+		return PageRateLimited, title
+	case containsAny(text, blockedMarkers):
+		return PageBlocked, title
+	case containsAny(text, serverErrorMarkers):
+		return PageServerError, title
+	case containsAny(strings.ToLower(title), searchMarkers),
+		doc.Find(`form[action*="Search"]`).Length() > 0:
+		return PageSearch, title
+	}
+	return PageUnknown, title
+}
+
+func containsAny(s string, markers []string) bool {
+	for _, m := range markers {
+		if strings.Contains(s, m) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package scraper
+
+import (
+	"os"
+	"testing"
+)
+
+func Test_classifyPage(t *testing.T) {
+	detail, err := os.ReadFile("../test_data/2163.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   PageKind
+	}{
+		{"detail", 200, string(detail), PageDetail},
+		{"detail with 500 status", 500, string(detail), PageServerError},
+		{"429", 429, "<html><title>Too Many Requests</title></html>", PageRateLimited},
+		{"rate limit notice", 200, "<html><title>Notice</title><body>You have exceeded the request limit.</body></html>", PageRateLimited},
+		{"captcha", 200, `<html><title>Security check</title><body><div class="g-recaptcha"></div></body></html>`, PageCaptcha},
+		{"forbidden", 403, "<html><title>403</title></html>", PageBlocked},
+		{"aspnet error", 200, "<html><title>Runtime Error</title><body><h1>Server Error in '/' Application.</h1></body></html>", PageServerError},
+		{"search page", 200, `<html><title>Comal CAD - Property Search</title><body><form action="PropertySearch.aspx?cid=56"></form></body></html>`, PageSearch},
+		{"empty", 200, "", PageUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := classifyPage(tt.status, []byte(tt.body))
+			if got != tt.want {
+				t.Errorf("classifyPage() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
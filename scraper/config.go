@@ -0,0 +1,220 @@
+package scraper
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	defaultBaseURL        = "https://propaccess.trueautomation.com"
+	defaultClientID       = "56"
+	defaultSessionMaxUses = 25
+	defaultSessionMaxAge  = 15 * time.Minute
+	defaultMaxAttempts    = 3
+	defaultRate           = 2
+	defaultMinRate        = 0.2
+	defaultMaxRate        = 10
+	defaultRateStep       = 0.1
+	defaultProxyRate      = 0.5
+	defaultShutdownGrace  = 30 * time.Second
+	defaultBatchSize      = 100
+	defaultPersistBatch   = 25
+	defaultPersistFlush   = 2 * time.Second
+	defaultRefreshMaxAge  = 30 * 24 * time.Hour
+	defaultRefreshTick    = time.Minute
+)
+
+type Config struct {
+	BaseURL  string
+	ClientID string
+
+	BatchSize     int
+	ShutdownGrace time.Duration
+
+	// FetchWorkers, ParseWorkers and PersistWorkers size the three pipeline
+	// stages; StageBuffer bounds the channels between them.
+	FetchWorkers   int
+	ParseWorkers   int
+	PersistWorkers int
+	StageBuffer    int
+	PersistBatch   int
+	PersistFlush   time.Duration
+
+	SessionMaxUses int
+	SessionMaxAge  time.Duration
+
+	MaxAttempts int
+
+	// Log receives the scraper's progress messages. When it is nil they go
+	// to stdout.
+	Log io.Writer
+
+	// Fetcher gets detail pages. When it is nil they are fetched from the
+	// live site with an HTTPFetcher.
+	Fetcher Fetcher
+
+	// Sink receives parsed records. When it is nil they are written to
+	// Postgres through the scraper's db.
+	Sink Sink
+
+	// RefreshMaxAge is how long a property may go unfetched before refresh
+	// mode revisits it; RefreshWindow is the time refresh mode aims to take
+	// to work through the whole county, checked every RefreshTick.
+	RefreshMaxAge time.Duration
+	RefreshWindow time.Duration
+	RefreshTick   time.Duration
+
+	// Rate is the starting number of requests per second across all
+	// workers; the limiter moves it between MinRate and MaxRate.
+	Rate       float64
+	Burst      int
+	MinRate    float64
+	MaxRate    float64
+	RateStep   float64
+	ProxyRate  float64
+	ProxyBurst int
+
+	// ProxyMaxLeases is how many workers may hold the same proxy at once.
+	// It is counted per process, not across scrapers sharing a database.
+	ProxyMaxLeases int
+
+	// ProxyMode decides whether requests go through the proxy pool; in
+	// ProxyModeMixed, DirectShare is the share of jobs that go direct.
+	ProxyMode   ProxyMode
+	DirectShare float64
+}
+
+type ProxyMode string
+
+const (
+	// ProxyModeNone sends every request directly from this machine. The
+	// direct connection is one address to the site, so it is held to
+	// ProxyRate like any one proxy, as well as to the global rate.
+	ProxyModeNone ProxyMode = "none"
+	// ProxyModePool sends every request through a proxy leased from the
+	// pool, and holds jobs back while no proxy is in rotation.
+	ProxyModePool ProxyMode = "pool"
+	// ProxyModeMixed sends DirectShare of jobs directly and the rest
+	// through the pool, going direct whenever the pool is empty.
+	ProxyModeMixed ProxyMode = "mixed"
+)
+
+func ParseProxyMode(s string) (ProxyMode, error) {
+	switch m := ProxyMode(s); m {
+	case ProxyModeNone, ProxyModePool, ProxyModeMixed:
+		return m, nil
+	case "":
+		return ProxyModePool, nil
+	default:
+		return "", fmt.Errorf("unknown proxy mode %q: want none, pool or mixed", s)
+	}
+}
+
+func (c Config) withDefaults() Config {
+	if c.BaseURL == "" {
+		c.BaseURL = defaultBaseURL
+	}
+	c.BaseURL = strings.TrimRight(c.BaseURL, "/")
+	if c.ClientID == "" {
+		c.ClientID = defaultClientID
+	}
+	if c.Log == nil {
+		c.Log = os.Stdout
+	}
+	if c.FetchWorkers <= 0 {
+		c.FetchWorkers = runtime.NumCPU()
+	}
+	if c.ParseWorkers <= 0 {
+		c.ParseWorkers = runtime.NumCPU()
+	}
+	if c.PersistWorkers <= 0 {
+		c.PersistWorkers = 1
+	}
+	if c.StageBuffer <= 0 {
+		c.StageBuffer = 2 * c.FetchWorkers
+	}
+	if c.PersistBatch <= 0 {
+		c.PersistBatch = defaultPersistBatch
+	}
+	if c.PersistFlush <= 0 {
+		c.PersistFlush = defaultPersistFlush
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = defaultBatchSize
+	}
+	if c.ShutdownGrace <= 0 {
+		c.ShutdownGrace = defaultShutdownGrace
+	}
+	if c.SessionMaxUses <= 0 {
+		c.SessionMaxUses = defaultSessionMaxUses
+	}
+	if c.SessionMaxAge <= 0 {
+		c.SessionMaxAge = defaultSessionMaxAge
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = defaultMaxAttempts
+	}
+	if c.RefreshMaxAge <= 0 {
+		c.RefreshMaxAge = defaultRefreshMaxAge
+	}
+	if c.RefreshWindow <= 0 {
+		c.RefreshWindow = c.RefreshMaxAge
+	}
+	if c.RefreshTick <= 0 {
+		c.RefreshTick = defaultRefreshTick
+	}
+	if c.Rate <= 0 {
+		c.Rate = defaultRate
+	}
+	if c.Burst <= 0 {
+		c.Burst = 1
+	}
+	if c.MinRate <= 0 {
+		c.MinRate = defaultMinRate
+	}
+	if c.MaxRate <= 0 {
+		c.MaxRate = defaultMaxRate
+	}
+	if c.RateStep <= 0 {
+		c.RateStep = defaultRateStep
+	}
+	if c.ProxyRate <= 0 {
+		c.ProxyRate = defaultProxyRate
+	}
+	if c.ProxyBurst <= 0 {
+		c.ProxyBurst = 1
+	}
+	if c.ProxyMaxLeases <= 0 {
+		c.ProxyMaxLeases = 1
+	}
+	if c.ProxyMode == "" {
+		c.ProxyMode = ProxyModePool
+	}
+	if c.DirectShare < 0 {
+		c.DirectShare = 0
+	}
+	if c.DirectShare > 1 {
+		c.DirectShare = 1
+	}
+	return c
+}
+
+func (c Config) landingURL() string {
+	return c.BaseURL + "/clientdb/?cid=" + c.ClientID
+}
+
+func (c Config) searchURL() string {
+	return c.BaseURL + "/clientdb/SearchResults.aspx?cid=" + c.ClientID
+}
+
+func (c Config) detailURL(propertyID int32) string {
+	return fmt.Sprintf("%s/clientdb/Property.aspx?cid=%s&prop_id=%d", c.BaseURL, c.ClientID, propertyID)
+}
+
+func (c Config) detailYearURL(propertyID int32, year int) string {
+	return fmt.Sprintf("%s&year=%d", c.detailURL(propertyID), year)
+}
@@ -0,0 +1,92 @@
+package scraper
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/jason-costello/taxcollector/storage/pgdb"
+)
+
+// deadLetterBodyLimit caps how much of the last response is kept with a dead
+// letter; enough to see what the page was without storing whole documents.
+const deadLetterBodyLimit = 64 << 10
+
+// errorChain lists err and everything it wraps, outermost first, so the
+// stored dead letter shows where a failure came from and not just its text.
+func errorChain(err error) []string {
+	var chain []string
+	for ; err != nil; err = errors.Unwrap(err) {
+		chain = append(chain, fmt.Sprintf("%T: %s", err, err))
+	}
+	return chain
+}
+
+// deadLetterable reports whether a job that failed for good should be moved to
+// the dead-letter table. Jobs cut short by shutdown are released instead,
+// since nothing is wrong with them.
+func (s *Scraper) deadLetterable(ctx context.Context, j Job) bool {
+	return s.db != nil && ctx.Err() == nil && !errors.Is(j.Error, context.Canceled)
+}
+
+// deadLetter records the job's last response and error in dead_letters and
+// takes its url off the pending queue, in one transaction.
+func (s *Scraper) deadLetter(ctx context.Context, j Job) error {
+	header := j.Header
+	if header == nil {
+		header = http.Header{}
+	}
+	headers, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	chain, err := json.Marshal(errorChain(j.Error))
+	if err != nil {
+		return err
+	}
+
+	body, truncated := j.Body, false
+	if len(body) > deadLetterBodyLimit {
+		body, truncated = body[:deadLetterBodyLimit], true
+	}
+	if body == nil {
+		body = []byte{}
+	}
+
+	params := pgdb.UpsertDeadLetterParams{
+		Url:           j.URL,
+		PropertyID:    stringToNullInt32(j.PropertyRecord.PropertyID),
+		Attempts:      int32(j.Attempts),
+		Headers:       headers,
+		Body:          body,
+		BodyTruncated: truncated,
+		Proxy:         j.Proxy.Addr(),
+		UserAgent:     j.UserAgent,
+		LastError:     j.Error.Error(),
+		ErrorChain:    chain,
+	}
+	if j.TaxYear != 0 {
+		params.TaxYear = sql.NullInt32{Int32: int32(j.TaxYear), Valid: true}
+	}
+	if j.Status != 0 {
+		params.Status = sql.NullInt32{Int32: int32(j.Status), Valid: true}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	q := s.pdb.WithTx(tx)
+	if err := q.UpsertDeadLetter(ctx, params); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("UpsertDeadLetter: %w", err)
+	}
+	if err := q.RemovePendingURL(ctx, j.URL); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("RemovePendingURL: %w", err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,51 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/jason-costello/taxcollector/storage/pgdb"
+)
+
+func Test_errorChain(t *testing.T) {
+	base := errors.New("connection reset")
+	err := fmt.Errorf("sessions.Do: %w", base)
+
+	want := []string{
+		"*fmt.wrapError: sessions.Do: connection reset",
+		"*errors.errorString: connection reset",
+	}
+	if got := errorChain(err); !reflect.DeepEqual(got, want) {
+		t.Errorf("errorChain() = %q, want %q", got, want)
+	}
+	if got := errorChain(nil); got != nil {
+		t.Errorf("errorChain(nil) = %q, want nil", got)
+	}
+}
+
+func TestScraper_deadLetterKeepsPriority(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	const u = "https://example.com/clientdb/Property.aspx?cid=56&prop_id=2163&year=2015"
+	if _, err := db.Exec("insert into pending_urls (url, priority) values ($1, 5)", u); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Scraper{db: db, pdb: pgdb.New(db)}
+	if err := s.deadLetter(ctx, Job{URL: u, TaxYear: 2015, Attempts: 3, Error: errors.New("captcha")}); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, db, "select count(*) from dead_letters where url = $1 and priority = 5", u); n != 1 {
+		t.Fatal("dead letter did not keep the pending url's priority")
+	}
+
+	if _, err := s.pdb.RequeueDeadLetters(ctx, "%captcha%"); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, db, "select count(*) from pending_urls where url = $1 and priority = 5", u); n != 1 {
+		t.Error("requeued url lost its priority")
+	}
+}
@@ -0,0 +1,68 @@
+package scraper
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"golang.org/x/net/html/charset"
+)
+
+// readBody returns the response body decompressed according to its
+// Content-Encoding and converted to UTF-8 according to its charset. Setting
+// Accept-Encoding by hand turns off the transport's own gzip handling, so
+// every encoding we advertise has to be undone here.
+func readBody(resp *http.Response) ([]byte, error) {
+	var r io.Reader = resp.Body
+
+	encodings := strings.Split(resp.Header.Get("Content-Encoding"), ",")
+	for i := len(encodings) - 1; i >= 0; i-- {
+		var err error
+		r, err = decodeContent(strings.TrimSpace(encodings[i]), r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r, err := charset.NewReader(r, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(r)
+}
+
+func decodeContent(encoding string, r io.Reader) (io.Reader, error) {
+	switch strings.ToLower(encoding) {
+	case "", "identity":
+		return r, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		return newDeflateReader(r)
+	case "br":
+		return brotli.NewReader(r), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
+
+// newDeflateReader handles both the zlib-wrapped stream the RFC asks for and
+// the raw deflate stream some servers send instead.
+func newDeflateReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
@@ -0,0 +1,132 @@
+package scraper
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"golang.org/x/text/encoding/charmap"
+)
+
+func encodeBody(t *testing.T, encoding string, body []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = fw
+	case "br":
+		w = brotli.NewWriter(&buf)
+	default:
+		return body
+	}
+	if _, err := w.Write(body); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func Test_readBody(t *testing.T) {
+	page, err := os.ReadFile("../test_data/2163.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		encoding       string
+		headerEncoding string
+	}{
+		{"identity", "", ""},
+		{"gzip", "gzip", "gzip"},
+		{"deflate", "deflate", "deflate"},
+		{"raw deflate", "raw-deflate", "deflate"},
+		{"brotli", "br", "br"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := encodeBody(t, tt.encoding, page)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				if tt.headerEncoding != "" {
+					w.Header().Set("Content-Encoding", tt.headerEncoding)
+				}
+				w.Write(body)
+			}))
+			defer srv.Close()
+
+			req, err := http.NewRequest("GET", srv.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			got, err := readBody(resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, page) {
+				t.Fatalf("decoded body differs from fixture: got %d bytes, want %d", len(got), len(page))
+			}
+			if kind, _ := classifyPage(resp.StatusCode, got); kind != PageDetail {
+				t.Errorf("classifyPage() = %s, want %s", kind, PageDetail)
+			}
+		})
+	}
+}
+
+func Test_readBodyCharset(t *testing.T) {
+	latin1, err := charmap.Windows1252.NewEncoder().Bytes([]byte("<html><body>Señor Café</body></html>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=windows-1252")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(encodeBody(t, "gzip", latin1))
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	got, err := readBody(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<html><body>Señor Café</body></html>"; string(got) != want {
+		t.Errorf("readBody() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,64 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// DirFetcher serves detail pages saved in a directory instead of fetching
+// them, so the pipeline can be run offline and gives the same result every
+// time. A job's page is read from <propertyID>-<year>.html when it asks for a
+// tax year and that file exists, and from <propertyID>.html otherwise, which
+// is how the pages in test_data are named.
+type DirFetcher struct {
+	dir string
+}
+
+func NewDirFetcher(dir string) *DirFetcher {
+	return &DirFetcher{dir: dir}
+}
+
+func (f *DirFetcher) Fetch(ctx context.Context, j *Job) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b, err := f.read(j)
+	if err != nil {
+		return fmt.Errorf("DirFetcher: %w", err)
+	}
+	j.Status = http.StatusOK
+	j.Header = http.Header{"Content-Type": []string{"text/html; charset=utf-8"}}
+	j.Body = b
+
+	if kind, title := classifyPage(http.StatusOK, b); kind != PageDetail {
+		return fmt.Errorf("classifyPage: %w", &UnexpectedPageError{Kind: kind, Status: http.StatusOK, Title: title})
+	}
+
+	if j.TaxYear != 0 {
+		selected, _, err := yearSelector(b)
+		if err != nil {
+			return fmt.Errorf("yearSelector: %w", err)
+		}
+		if selected != j.TaxYear {
+			return fmt.Errorf("%w: %d, saved page shows %d", ErrYearNotOffered, j.TaxYear, selected)
+		}
+	}
+	return nil
+}
+
+func (f *DirFetcher) read(j *Job) ([]byte, error) {
+	id := j.PropertyRecord.PropertyID
+	if j.TaxYear != 0 {
+		b, err := os.ReadFile(filepath.Join(f.dir, id+"-"+strconv.Itoa(j.TaxYear)+".html"))
+		if err == nil || !errors.Is(err, os.ErrNotExist) {
+			return b, err
+		}
+	}
+	return os.ReadFile(filepath.Join(f.dir, id+".html"))
+}
@@ -0,0 +1,70 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jason-costello/taxcollector/tax"
+)
+
+func TestDirFetcher(t *testing.T) {
+	f := NewDirFetcher("../test_data")
+	ctx := context.Background()
+
+	j := Job{PropertyRecord: tax.PropertyRecord{PropertyID: "2163"}}
+	if err := f.Fetch(ctx, &j); err != nil {
+		t.Fatal(err)
+	}
+	if j.Status != 200 || len(j.Body) == 0 {
+		t.Errorf("Fetch() left status %d and %d bytes", j.Status, len(j.Body))
+	}
+
+	missing := Job{PropertyRecord: tax.PropertyRecord{PropertyID: "1"}}
+	if err := f.Fetch(ctx, &missing); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Fetch() of a missing page = %v, want os.ErrNotExist", err)
+	}
+
+	otherYear := Job{TaxYear: 2015, PropertyRecord: tax.PropertyRecord{PropertyID: "2163"}}
+	if err := f.Fetch(ctx, &otherYear); !errors.Is(err, ErrYearNotOffered) {
+		t.Errorf("Fetch() of an unsaved year = %v, want ErrYearNotOffered", err)
+	}
+}
+
+func TestScrapeReplay(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewScraper(nil, nil, nil, nil, Config{
+		Fetcher:      NewDirFetcher("../test_data"),
+		Sink:         NewJSONLinesSink(&buf, false),
+		FetchWorkers: 2,
+		PersistFlush: 10 * time.Millisecond,
+	})
+
+	urls := []string{
+		"https://propaccess.trueautomation.com/clientdb/Property.aspx?cid=56&prop_id=2163",
+		"https://propaccess.trueautomation.com/clientdb/Property.aspx?cid=56&prop_id=114173",
+		"https://propaccess.trueautomation.com/clientdb/Property.aspx?cid=56&prop_id=1",
+	}
+	result := s.Scrape(context.Background(), NewSliceQueue(urls))
+
+	if result.Total != 3 || result.Succeeded != 2 || result.Failed != 1 {
+		t.Errorf("Scrape() = %s", result)
+	}
+
+	dec := json.NewDecoder(&buf)
+	seen := make(map[string]bool)
+	for dec.More() {
+		var pr tax.PropertyRecord
+		if err := dec.Decode(&pr); err != nil {
+			t.Fatal(err)
+		}
+		seen[pr.PropertyID] = true
+	}
+	if !seen["2163"] || !seen["114173"] {
+		t.Errorf("records written for %v, want 2163 and 114173", seen)
+	}
+}
@@ -0,0 +1,351 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/jason-costello/taxcollector/proxies"
+	"github.com/jason-costello/taxcollector/tax"
+	"github.com/jason-costello/taxcollector/useragents"
+)
+
+// Fetcher gets the detail page for a job. On success j.Body holds the page
+// for j.URL, in j.TaxYear when one was asked for. Whatever was received is
+// left in j.Status, j.Header and j.Body even on failure, and j.Requeue is set
+// when trying again later might succeed.
+type Fetcher interface {
+	Fetch(ctx context.Context, j *Job) error
+}
+
+// HTTPFetcher fetches pages from the live site through the proxy pool, one
+// bootstrapped session per proxy, under the rate limiter.
+type HTTPFetcher struct {
+	proxyClient *proxies.ProxyClient
+	limiter     *Limiter
+	sessions    *SessionManager
+	maxLeases   int
+	mode        ProxyMode
+	directShare float64
+	random      func() float64
+	// search is the page detail requests are sent as having come from.
+	search  string
+	landing string
+	log     io.Writer
+}
+
+// NewHTTPFetcher returns a fetcher for the site in cfg, using the proxy pool
+// as cfg.ProxyMode says. Without a proxy client requests go out directly
+// whatever the mode. Each request is bounded by httpClient's Timeout, 30
+// seconds when httpClient is nil.
+func NewHTTPFetcher(proxyClient *proxies.ProxyClient, uac *useragents.UserAgentClient, httpClient *http.Client, cfg Config) *HTTPFetcher {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	cfg = cfg.withDefaults()
+	limiter := NewLimiter(cfg)
+
+	mode := cfg.ProxyMode
+	if proxyClient == nil {
+		mode = ProxyModeNone
+	}
+
+	return &HTTPFetcher{
+		proxyClient: proxyClient,
+		limiter:     limiter,
+		sessions:    NewSessionManager(httpClient, limiter, uac, cfg),
+		search:      cfg.searchURL(),
+		landing:     cfg.landingURL(),
+		log:         cfg.Log,
+		maxLeases:   cfg.ProxyMaxLeases,
+		mode:        mode,
+		directShare: cfg.DirectShare,
+		random:      rand.Float64,
+	}
+}
+
+// noProxiesRetry is how long a pool-mode lease waits before looking again
+// when no proxy is in rotation.
+const noProxiesRetry = 5 * time.Second
+
+// leaseProxy returns the proxy the job goes out on, or the zero Proxy for a
+// direct connection. In pool mode having no proxy in rotation is taken to be
+// passing, as when the health checker has every proxy cooling down, so it
+// waits for one to come back until ctx ends rather than fail the job.
+func (f *HTTPFetcher) leaseProxy(ctx context.Context) (proxies.Proxy, error) {
+	switch f.mode {
+	case ProxyModeNone:
+		return proxies.Proxy{}, nil
+	case ProxyModeMixed:
+		if f.random() < f.directShare {
+			return proxies.Proxy{}, nil
+		}
+		p, err := f.proxyClient.Lease(ctx, f.maxLeases)
+		if errors.Is(err, proxies.ErrNoProxies) {
+			return proxies.Proxy{}, nil
+		}
+		return p, err
+	default:
+		for {
+			p, err := f.proxyClient.Lease(ctx, f.maxLeases)
+			if !errors.Is(err, proxies.ErrNoProxies) {
+				return p, err
+			}
+			t := time.NewTimer(noProxiesRetry)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return proxies.Proxy{}, fmt.Errorf("%w: %s", ctx.Err(), err)
+			case <-t.C:
+			}
+		}
+	}
+}
+
+// releaseProxy hands the job's proxy back with the outcome of its last
+// request.
+func (f *HTTPFetcher) releaseProxy(j *Job) {
+	if f.proxyClient == nil || j.Proxy.IP == "" {
+		return
+	}
+	f.proxyClient.Release(j.Proxy, proxies.Event{
+		Outcome: j.ProxyOutcome,
+		Status:  j.Status,
+		Latency: j.ProxyLatency,
+		URL:     j.URL,
+	})
+}
+
+func (f *HTTPFetcher) markProxyBad(ctx context.Context, j *Job) {
+	if f.proxyClient == nil || j.Proxy.IP == "" {
+		return
+	}
+	if err := f.proxyClient.MarkProxyAsBad(ctx, j.Proxy.Addr()); err != nil {
+		fmt.Fprintf(f.log, "worker: %d   jobID: %d  proxyClient.MarkProxyAsBad: %s\n", j.ProcessorID, j.JobID, err)
+	}
+}
+
+func (f *HTTPFetcher) Fetch(ctx context.Context, j *Job) error {
+	var err error
+	j.Proxy, err = f.leaseProxy(ctx)
+	if err != nil {
+		j.Requeue = true
+		return fmt.Errorf("proxyClient.Lease: %w", err)
+	}
+	defer f.releaseProxy(j)
+
+	// Requests are bounded by the http client's timeout rather than ctx, so
+	// time spent waiting on the limiter does not count against them.
+	limitKey := sessionKey(j.Proxy)
+
+	s, err := f.sessions.Get(ctx, j.Proxy)
+	if abandoned(ctx, err) {
+		j.Requeue = true
+		return fmt.Errorf("sessions.Get: %w", err)
+	}
+	if err != nil {
+		fmt.Fprintf(f.log, "worker: %d   jobID: %d  Bad proxy: %s\n", j.ProcessorID, j.JobID, err)
+		f.limiter.Report(limitKey, outcomeFor(0, PageUnknown, err), 0)
+		if isTimeout(err) {
+			j.ProxyOutcome = proxies.OutcomeTimeout
+		}
+		f.sessions.InvalidateProxy(j.Proxy)
+		f.markProxyBad(ctx, j)
+		j.Requeue = true
+		return fmt.Errorf("sessions.Get: %w", err)
+	}
+	j.UserAgent = s.Profile().UserAgent
+
+	req, err := http.NewRequestWithContext(ctx, "GET", j.URL, nil)
+	if err != nil {
+		return fmt.Errorf("http.NewRequestWithContext: %w", err)
+	}
+	req.Header.Set("Referer", f.search)
+	fmt.Fprintf(f.log, "worker: %d   jobID: %d  Property Request\n", j.ProcessorID, j.JobID)
+
+	b, err := f.send(ctx, j, req, limitKey)
+	if err != nil {
+		return err
+	}
+
+	if j.TaxYear != 0 {
+		if b, err = f.selectYear(ctx, j, req, b, limitKey); err != nil {
+			return err
+		}
+	}
+
+	j.Body = b
+	return nil
+}
+
+// SourceUpdatedAt reads the date the county last updated its database off the
+// landing page's footer, through the proxy pool like any other request. It
+// returns the zero time when the footer does not give one.
+func (f *HTTPFetcher) SourceUpdatedAt(ctx context.Context) (time.Time, error) {
+	j := &Job{URL: f.landing}
+	var err error
+	if j.Proxy, err = f.leaseProxy(ctx); err != nil {
+		return time.Time{}, fmt.Errorf("proxyClient.Lease: %w", err)
+	}
+	defer f.releaseProxy(j)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", f.landing, nil)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("http.NewRequestWithContext: %w", err)
+	}
+	resp, err := f.sessions.Do(ctx, j.Proxy, req)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("sessions.Do: %w", err)
+	}
+	defer resp.Body.Close()
+	j.Status = resp.StatusCode
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("landing page: %s", resp.Status)
+	}
+
+	b, err := readBody(resp)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("readBody: %w", err)
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(b))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("goquery.NewDocumentFromReader: %w", err)
+	}
+	return tax.SourceUpdatedAt(doc), nil
+}
+
+// abandoned reports whether err is from a request that was held back by the
+// limiter or given up by the caller, as on shutdown, rather than one the site
+// or the proxy failed. Such errors are not held against either.
+func abandoned(ctx context.Context, err error) bool {
+	if err == nil {
+		return false
+	}
+	return isWaitError(err) || ctx.Err() != nil || errors.Is(err, context.Canceled)
+}
+
+// send makes one request on the job's proxy session and classifies the
+// response, which is kept on the job in case it ends up dead-lettered.
+// Anything but a detail page is an error and marks the job for requeueing.
+func (f *HTTPFetcher) send(ctx context.Context, j *Job, req *http.Request, limitKey string) ([]byte, error) {
+	start := time.Now()
+	resp, err := f.sessions.Do(req.Context(), j.Proxy, req)
+	if abandoned(ctx, err) {
+		j.Requeue = true
+		return nil, fmt.Errorf("sessions.Do: %w", err)
+	}
+	if err != nil {
+		f.limiter.Report(limitKey, outcomeFor(0, PageUnknown, err), 0)
+		if isTimeout(err) {
+			j.ProxyOutcome = proxies.OutcomeTimeout
+		}
+		j.Requeue = true
+		return nil, fmt.Errorf("sessions.Do: %w", err)
+	}
+
+	b, err := readBody(resp)
+	resp.Body.Close()
+	if abandoned(ctx, err) {
+		j.Requeue = true
+		return nil, fmt.Errorf("readBody: %w", err)
+	}
+	if err != nil {
+		// A body cut short or that does not decode is the connection's
+		// fault, like a failed request, and may well load next time.
+		j.Status = resp.StatusCode
+		j.Header = resp.Header
+		f.limiter.Report(limitKey, outcomeFor(0, PageUnknown, err), 0)
+		if isTimeout(err) {
+			j.ProxyOutcome = proxies.OutcomeTimeout
+		}
+		j.Requeue = true
+		return nil, fmt.Errorf("readBody: %w", err)
+	}
+	j.Status = resp.StatusCode
+	j.Header = resp.Header
+	j.Body = b
+
+	kind, title := classifyPage(resp.StatusCode, b)
+	f.limiter.Report(limitKey, outcomeFor(resp.StatusCode, kind, nil), parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()))
+	switch {
+	case kind == PageDetail:
+		j.ProxyOutcome, j.ProxyLatency = proxies.OutcomeSuccess, time.Since(start)
+	case kind.ProxyAtFault():
+		j.ProxyOutcome = proxies.OutcomeBlocked
+	default:
+		j.ProxyOutcome = proxies.OutcomeNone
+	}
+	if kind != PageDetail {
+		j.Requeue = true
+		f.sessions.InvalidateProxy(j.Proxy)
+		if kind.ProxyAtFault() {
+			f.markProxyBad(ctx, j)
+		}
+		return nil, fmt.Errorf("classifyPage: %w", &UnexpectedPageError{Kind: kind, Status: resp.StatusCode, Title: title})
+	}
+	return b, nil
+}
+
+// selectYear makes sure page shows the job's tax year. The site does not
+// always honour the year in the url, so when it shows another year the page's
+// year selector is posted back the way the browser would. A year the property
+// does not offer fails with ErrYearNotOffered. The postback carries the
+// page's form state, so when the session is lost under it the detail page is
+// fetched again on the new session and the form rebuilt from that.
+func (f *HTTPFetcher) selectYear(ctx context.Context, j *Job, req *http.Request, page []byte, limitKey string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		b, err := f.postYear(ctx, j, req, page, limitKey)
+		if attempt > 0 || !errors.Is(err, ErrSessionLost) {
+			return b, err
+		}
+
+		fmt.Fprintf(f.log, "worker: %d   jobID: %d  Session lost on tax year postback, refetching\n", j.ProcessorID, j.JobID)
+		j.Requeue = false
+		if page, err = f.send(ctx, j, req, limitKey); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (f *HTTPFetcher) postYear(ctx context.Context, j *Job, req *http.Request, page []byte, limitKey string) ([]byte, error) {
+	selected, offered, err := yearSelector(page)
+	if err != nil {
+		return nil, fmt.Errorf("yearSelector: %w", err)
+	}
+	if selected == j.TaxYear {
+		return page, nil
+	}
+	if !offersYear(offered, j.TaxYear) {
+		return nil, fmt.Errorf("%w: %d", ErrYearNotOffered, j.TaxYear)
+	}
+
+	action, values, err := yearForm(page, req.URL, j.TaxYear)
+	if err != nil {
+		return nil, fmt.Errorf("yearForm: %w", err)
+	}
+	post, err := http.NewRequestWithContext(req.Context(), "POST", action, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("http.NewRequestWithContext: %w", err)
+	}
+	post.Header = req.Header.Clone()
+	post.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	post.Header.Set("Referer", req.URL.String())
+	fmt.Fprintf(f.log, "worker: %d   jobID: %d  Tax year %d postback\n", j.ProcessorID, j.JobID, j.TaxYear)
+
+	b, err := f.send(ctx, j, post, limitKey)
+	if err != nil {
+		return nil, err
+	}
+	if selected, _, err = yearSelector(b); err != nil || selected != j.TaxYear {
+		return nil, fmt.Errorf("selectYear: asked for tax year %d, page shows %d", j.TaxYear, selected)
+	}
+	return b, nil
+}
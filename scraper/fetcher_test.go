@@ -0,0 +1,102 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jason-costello/taxcollector/proxies"
+)
+
+func TestParseProxyMode(t *testing.T) {
+	for in, want := range map[string]ProxyMode{"": ProxyModePool, "none": ProxyModeNone, "pool": ProxyModePool, "mixed": ProxyModeMixed} {
+		if got, err := ParseProxyMode(in); err != nil || got != want {
+			t.Errorf("ParseProxyMode(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseProxyMode("socks"); err == nil {
+		t.Error("ParseProxyMode accepted an unknown mode")
+	}
+}
+
+func TestHTTPFetcher_leaseProxy(t *testing.T) {
+	f := NewHTTPFetcher(nil, nil, nil, Config{ProxyMode: ProxyModePool})
+	if f.mode != ProxyModeNone {
+		t.Errorf("fetcher without a proxy client is in mode %q, want none", f.mode)
+	}
+
+	// A mixed fetcher whose draw falls inside the direct share never
+	// touches the pool, which here would panic.
+	f = NewHTTPFetcher(&proxies.ProxyClient{}, nil, nil, Config{ProxyMode: ProxyModeMixed, DirectShare: 0.3})
+	f.random = func() float64 { return 0.29 }
+	p, err := f.leaseProxy(context.Background())
+	if err != nil || p.IP != "" {
+		t.Errorf("leaseProxy() = %+v, %v, want a direct connection", p, err)
+	}
+}
+
+func TestHTTPFetcher_limiterWait(t *testing.T) {
+	srv := newTestServer(t)
+	cfg := Config{BaseURL: srv.URL, Rate: 0.5, MinRate: 0.1, Burst: 1, ProxyRate: 1000, ProxyBurst: 10}
+	f := NewHTTPFetcher(nil, nil, nil, cfg)
+
+	// The bootstrap takes the only token, and the detail request would have
+	// to wait two seconds for the next.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	j := &Job{URL: detailURLs(srv, "2163")[0]}
+	err := f.Fetch(ctx, j)
+
+	if !isWaitError(err) {
+		t.Fatalf("Fetch() = %v, want a limiter wait error", err)
+	}
+	if !j.Requeue {
+		t.Error("job held back by the limiter not requeued")
+	}
+	if r := f.limiter.Rate(); r != 0.5 || f.limiter.aimd.total != 0 {
+		t.Errorf("a cut-short wait was reported to the limiter: rate %v, %d outcomes", r, f.limiter.aimd.total)
+	}
+	if n := srv.Hits("2163"); n != 0 {
+		t.Errorf("detail requested %d times, want the request held back", n)
+	}
+}
+
+func TestHTTPFetcher_canceled(t *testing.T) {
+	started := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	f := NewHTTPFetcher(nil, nil, nil, Config{BaseURL: srv.URL, Rate: 1000, MaxRate: 1000})
+
+	// Shutting down while the session is being bootstrapped.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	j := &Job{URL: srv.URL + "/clientdb/Property.aspx?cid=56&prop_id=2163"}
+	err := f.Fetch(ctx, j)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Fetch() = %v, want context.Canceled", err)
+	}
+	if j.ProxyOutcome != proxies.OutcomeNone || f.limiter.aimd.total != 0 {
+		t.Errorf("canceled bootstrap was held against the proxy (%s) or reported to the limiter (%d outcomes)", j.ProxyOutcome, f.limiter.aimd.total)
+	}
+}
+
+func TestHTTPFetcher_SourceUpdatedAt(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SourceUpdated = time.Date(2022, 5, 1, 21, 15, 0, 0, time.Local)
+	f := NewHTTPFetcher(nil, nil, nil, Config{BaseURL: srv.URL, Rate: 1000, MaxRate: 1000, ProxyRate: 1000})
+
+	got, err := f.SourceUpdatedAt(context.Background())
+	if err != nil || !got.Equal(srv.SourceUpdated) {
+		t.Errorf("SourceUpdatedAt() = %s, %v, want %s", got, err, srv.SourceUpdated)
+	}
+}
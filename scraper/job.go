@@ -0,0 +1,111 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jason-costello/taxcollector/proxies"
+	"github.com/jason-costello/taxcollector/tax"
+)
+
+type Job struct {
+	ProcessorID    int
+	JobID          int
+	URL            string
+	TaxYear        int
+	Proxy          proxies.Proxy
+	ProxyOutcome   proxies.Outcome
+	ProxyLatency   time.Duration
+	UserAgent      string
+	Status         int
+	Header         http.Header
+	Body           []byte
+	PropertyRecord tax.PropertyRecord
+	Unchanged      bool
+	Attempts       int
+	Requeue        bool
+	Error          error
+}
+
+func (j Job) retry() Job {
+	j.Requeue = false
+	j.Error = nil
+	j.Status = 0
+	j.Header = nil
+	j.Body = nil
+	j.Proxy = proxies.Proxy{}
+	j.ProxyOutcome = proxies.OutcomeNone
+	j.ProxyLatency = 0
+	return j
+}
+
+func (s *Scraper) jobError(ctx context.Context, j *Job, removeURL bool, fun string, nerr error) {
+	j.Error = nerr
+	if removeURL && s.db != nil {
+		if err := s.pdb.RemovePendingURL(ctx, j.URL); err != nil {
+			fmt.Fprintf(s.cfg.Log, "worker: %d   job: %d   propertyID: %s  error removing pending url: %s\n", j.ProcessorID, j.JobID, j.PropertyRecord.PropertyID, err)
+		}
+	}
+	fmt.Fprintf(s.cfg.Log, "worker: %d   job: %d   propertyID: %s  function: %s  error during processing: %s\n", j.ProcessorID, j.JobID, j.PropertyRecord.PropertyID, fun, nerr)
+}
+
+// fetch is the network stage: it hands the job to the fetcher, which leaves
+// the detail page in j.Body on success.
+func (s *Scraper) fetch(ctx context.Context, j *Job) {
+	j.Attempts++
+
+	if j.PropertyRecord.PropertyID == "" {
+		s.jobError(ctx, j, false, "strconv.Atoi(j.PropertyRecord.PropertyID)", errors.New("no property record id set"))
+		return
+	}
+	_, err := strconv.Atoi(j.PropertyRecord.PropertyID)
+	if err != nil {
+		s.jobError(ctx, j, false, "strconv.Atoi(j.PropertyRecord.PropertyID)", err)
+		return
+	}
+
+	if err := s.fetcher.Fetch(ctx, j); err != nil {
+		s.jobError(ctx, j, errors.Is(err, ErrYearNotOffered), "fetcher.Fetch", err)
+	}
+}
+
+func (s *Scraper) parse(ctx context.Context, j *Job) {
+	record, err := parseDetails(j.Body)
+	if err != nil {
+		s.jobError(ctx, j, false, "parseDetails(j.Body)", err)
+		return
+	}
+	if record.PropertyID == "" {
+		record.PropertyID = j.PropertyRecord.PropertyID
+	}
+	j.PropertyRecord = record
+	j.Body = nil
+}
+
+// persist hands a batch of parsed jobs to the sink, recording any failure on
+// the job it belongs to.
+func (s *Scraper) persist(ctx context.Context, batch []Job) {
+	records := make([]Record, len(batch))
+	for i, j := range batch {
+		records[i] = Record{URL: j.URL, TaxYear: j.TaxYear, Property: j.PropertyRecord}
+	}
+
+	results, err := s.sink.SaveBatch(ctx, records)
+	for i := range batch {
+		j := &batch[i]
+		if err != nil {
+			s.jobError(ctx, j, false, "sink.SaveBatch", err)
+			continue
+		}
+		if results[i].Err != nil {
+			s.jobError(ctx, j, false, "sink.SaveBatch", results[i].Err)
+			continue
+		}
+		j.Unchanged = !results[i].Changed
+		fmt.Fprintf(s.cfg.Log, "worker: %d  jobID: %d  propID: %s   done  changed: %t\n", j.ProcessorID, j.JobID, j.PropertyRecord.PropertyID, results[i].Changed)
+	}
+}
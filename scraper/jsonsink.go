@@ -0,0 +1,51 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/jason-costello/taxcollector/tax"
+)
+
+// JSONLinesSink writes each parsed record as one line of json instead of
+// saving it, for dry runs that should not touch Postgres. With a report each
+// line also carries the url and the record's parse report.
+type JSONLinesSink struct {
+	report bool
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+type jsonLine struct {
+	URL    string             `json:"url"`
+	Record tax.PropertyRecord `json:"record"`
+	Report tax.ParseReport    `json:"report"`
+}
+
+func NewJSONLinesSink(w io.Writer, report bool) *JSONLinesSink {
+	return &JSONLinesSink{
+		report: report,
+		enc:    json.NewEncoder(w),
+	}
+}
+
+func (js *JSONLinesSink) SaveBatch(ctx context.Context, records []Record) ([]SaveResult, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	results := make([]SaveResult, len(records))
+	for i, r := range records {
+		var v interface{} = r.Property
+		if js.report {
+			v = jsonLine{URL: r.URL, Record: r.Property, Report: r.Property.Report()}
+		}
+		if err := js.enc.Encode(v); err != nil {
+			return nil, err
+		}
+		results[i].Changed = true
+	}
+	return results, nil
+}
@@ -0,0 +1,48 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jason-costello/taxcollector/tax"
+)
+
+func TestJSONLinesSink(t *testing.T) {
+	records := []Record{
+		{URL: "https://example.com/Property.aspx?prop_id=1", Property: tax.PropertyRecord{PropertyID: "1"}},
+		{URL: "https://example.com/Property.aspx?prop_id=2", Property: tax.PropertyRecord{PropertyID: "2"}},
+	}
+
+	var buf bytes.Buffer
+	results, err := NewJSONLinesSink(&buf, true).SaveBatch(context.Background(), records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || !results[0].Changed {
+		t.Fatalf("results = %+v", results)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("wrote %d lines, want 2", len(lines))
+	}
+	var line jsonLine
+	if err := json.Unmarshal([]byte(lines[1]), &line); err != nil {
+		t.Fatal(err)
+	}
+	if line.URL != records[1].URL || line.Record.PropertyID != "2" {
+		t.Errorf("line 2 = %+v", line)
+	}
+
+	buf.Reset()
+	if _, err := NewJSONLinesSink(&buf, false).SaveBatch(context.Background(), records[:1]); err != nil {
+		t.Fatal(err)
+	}
+	var pr tax.PropertyRecord
+	if err := json.Unmarshal(buf.Bytes(), &pr); err != nil || pr.PropertyID != "1" {
+		t.Errorf("record without report = %q (%v)", buf.String(), err)
+	}
+}
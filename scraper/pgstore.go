@@ -0,0 +1,391 @@
+package scraper
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jason-costello/taxcollector/storage/pgdb"
+	"github.com/jason-costello/taxcollector/tax"
+)
+
+// Record is a parsed property on its way to the database. TaxYear is the year
+// that was asked for, or 0 when the page's default year was fetched.
+type Record struct {
+	URL      string
+	TaxYear  int
+	Property tax.PropertyRecord
+}
+
+// SaveResult reports what happened to one record in a batch. Changed is false
+// when the record matched the property's current snapshot and nothing was
+// written besides removing its pending url.
+type SaveResult struct {
+	Changed bool
+	Err     error
+}
+
+// Sink is where the persist stage sends parsed records. SaveBatch returns one
+// SaveResult per record, or an error when the batch as a whole failed.
+type Sink interface {
+	SaveBatch(ctx context.Context, records []Record) ([]SaveResult, error)
+}
+
+// PGStore writes parsed properties to Postgres. Saving is idempotent: the
+// property row is upserted, its land, jurisdiction and improvement rows for
+// the record's tax year are replaced, and roll values are upserted by year,
+// so re-scraping a property overwrites it rather than failing or duplicating.
+// Fields that vary by tax year are also kept per year in property_tax_years.
+// Every change is also kept as a snapshot in property_snapshots, so the
+// property's earlier states can still be read back. Each save, changed or
+// not, of the default year stamps the property's last_fetched_at for refresh
+// scheduling.
+type PGStore struct {
+	db  *sql.DB
+	pdb *pgdb.Queries
+}
+
+func NewPGStore(db *sql.DB) *PGStore {
+	return &PGStore{
+		db:  db,
+		pdb: pgdb.New(db),
+	}
+}
+
+// SaveBatch writes every record in a single transaction. Each record gets its
+// own savepoint, so a record that fails is rolled back alone and its error is
+// returned at the same index while the rest of the batch still commits. The
+// second return value is set when the transaction as a whole failed.
+func (st *PGStore) SaveBatch(ctx context.Context, records []Record) ([]SaveResult, error) {
+	results := make([]SaveResult, len(records))
+
+	tx, err := st.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	q := st.pdb.WithTx(tx)
+
+	for i, r := range records {
+		if _, err := tx.ExecContext(ctx, "savepoint record"); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		changed, err := saveRecord(ctx, q, r)
+		if err != nil {
+			results[i].Err = fmt.Errorf("propID: %s: %w", r.Property.PropertyID, err)
+			if _, err := tx.ExecContext(ctx, "rollback to savepoint record"); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			continue
+		}
+		results[i].Changed = changed
+
+		if _, err := tx.ExecContext(ctx, "release savepoint record"); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return results, nil
+}
+
+// saveRecord compares the record against the property's current snapshot for
+// its tax year. Unchanged records leave the tables alone; changed ones are
+// written, the current snapshot is closed and a new one opened in its place.
+func saveRecord(ctx context.Context, q *pgdb.Queries, r Record) (bool, error) {
+	pr := r.Property
+	propertyID := stringToNullInt32(pr.PropertyID)
+	year := taxYear(pr, r.TaxYear)
+
+	hash, content, err := pr.Hash()
+	if err != nil {
+		return false, fmt.Errorf("Hash: %w", err)
+	}
+
+	current, err := q.GetCurrentPropertySnapshot(ctx, pgdb.GetCurrentPropertySnapshotParams{PropertyID: propertyID.Int32, TaxYear: year.Int32})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("GetCurrentPropertySnapshot: %w", err)
+	}
+	changed := err != nil || current.ContentHash != hash
+
+	if changed {
+		if err := writeRecord(ctx, q, pr, propertyID, year, r.TaxYear == 0); err != nil {
+			return false, err
+		}
+
+		if current.ID != 0 {
+			if err := q.ClosePropertySnapshot(ctx, current.ID); err != nil {
+				return false, fmt.Errorf("ClosePropertySnapshot: %w", err)
+			}
+		}
+		snapshot := pgdb.InsertPropertySnapshotParams{
+			PropertyID:  propertyID.Int32,
+			TaxYear:     year.Int32,
+			ContentHash: hash,
+			Record:      content,
+		}
+		if _, err := q.InsertPropertySnapshot(ctx, snapshot); err != nil {
+			return false, fmt.Errorf("InsertPropertySnapshot: %w", err)
+		}
+	}
+
+	// Backfilling an old year says nothing about how fresh the current year
+	// is, so only default-year fetches count towards refresh scheduling.
+	if r.TaxYear == 0 {
+		fetched := pgdb.MarkPropertyFetchedParams{ID: propertyID.Int32}
+		if !pr.SourceUpdatedAt.IsZero() {
+			fetched.SourceUpdatedAt = sql.NullTime{Time: pr.SourceUpdatedAt, Valid: true}
+		}
+		if err := q.MarkPropertyFetched(ctx, fetched); err != nil {
+			return false, fmt.Errorf("MarkPropertyFetched: %w", err)
+		}
+	}
+
+	if r.URL != "" {
+		if err := q.RemovePendingURL(ctx, r.URL); err != nil {
+			return false, fmt.Errorf("RemovePendingURL: %w", err)
+		}
+	}
+	return changed, nil
+}
+
+// writeRecord replaces the property's rows for the year. The child rows of a
+// default-year fetch also replace any left untagged from before rows carried
+// their tax year, which were all default-year fetches too.
+func writeRecord(ctx context.Context, q *pgdb.Queries, pr tax.PropertyRecord, propertyID, year sql.NullInt32, defaultYear bool) error {
+	if err := upsertPropertyRecord(ctx, q, pr, year, defaultYear); err != nil {
+		return fmt.Errorf("upsertPropertyRecord: %w", err)
+	}
+
+	if err := upsertPropertyTaxYear(ctx, q, pr, propertyID, year); err != nil {
+		return fmt.Errorf("upsertPropertyTaxYear: %w", err)
+	}
+
+	if err := deleteTaxYear(ctx, q, propertyID, year, defaultYear); err != nil {
+		return fmt.Errorf("deleteTaxYear: %w", err)
+	}
+
+	if err := insertImprovements(ctx, q, pr, year); err != nil {
+		return fmt.Errorf("insertImprovements: %w", err)
+	}
+
+	if err := insertJurisdictions(ctx, q, pr, year); err != nil {
+		return fmt.Errorf("insertJurisdictions: %w", err)
+	}
+
+	if err := insertLand(ctx, q, pr, year); err != nil {
+		return fmt.Errorf("insertLand: %w", err)
+	}
+
+	if err := upsertRollValues(ctx, q, pr); err != nil {
+		return fmt.Errorf("upsertRollValues: %w", err)
+	}
+	return nil
+}
+
+// taxYear is the year selected on the detail page. When the page does not
+// say, it is the year the job asked for, or the current year for a
+// default-year job.
+func taxYear(pr tax.PropertyRecord, asked int) sql.NullInt32 {
+	if y, err := strconv.Atoi(pr.TaxYear); err == nil && y > 0 {
+		return sql.NullInt32{Int32: int32(y), Valid: true}
+	}
+	if asked > 0 {
+		return sql.NullInt32{Int32: int32(asked), Valid: true}
+	}
+	return sql.NullInt32{Int32: int32(time.Now().Year()), Valid: true}
+}
+
+func deleteTaxYear(ctx context.Context, q *pgdb.Queries, propertyID, year sql.NullInt32, untagged bool) error {
+	if err := q.DeleteImprovementDetailsByPropertyYear(ctx, pgdb.DeleteImprovementDetailsByPropertyYearParams{PropertyID: propertyID, TaxYear: year, Untagged: untagged}); err != nil {
+		return err
+	}
+	if err := q.DeleteImprovementsByPropertyYear(ctx, pgdb.DeleteImprovementsByPropertyYearParams{PropertyID: propertyID, TaxYear: year, Untagged: untagged}); err != nil {
+		return err
+	}
+	if err := q.DeleteJurisdictionsByPropertyYear(ctx, pgdb.DeleteJurisdictionsByPropertyYearParams{PropertyID: propertyID, TaxYear: year, Untagged: untagged}); err != nil {
+		return err
+	}
+	return q.DeleteLandByPropertyYear(ctx, pgdb.DeleteLandByPropertyYearParams{PropertyID: propertyID, TaxYear: year, Untagged: untagged})
+}
+
+func stringToNullInt32(s string) sql.NullInt32 {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		i = 0
+	}
+	return sql.NullInt32{
+		Int32: int32(i),
+		Valid: true,
+	}
+}
+
+func stringToNullFloat64(s string) sql.NullFloat64 {
+	i, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		i = 0.0
+	}
+	return sql.NullFloat64{
+		Float64: i,
+		Valid:   true,
+	}
+}
+
+func stringToNullString(s string) sql.NullString {
+	return sql.NullString{
+		String: s,
+		Valid:  true,
+	}
+}
+
+func stringToInt32(s string) int32 {
+	i, e := strconv.Atoi(s)
+	if e != nil {
+		return int32(0)
+	}
+	return int32(i)
+}
+
+func insertLand(ctx context.Context, q *pgdb.Queries, pr tax.PropertyRecord, year sql.NullInt32) error {
+	for _, i := range pr.Land {
+
+		landParams := pgdb.InsertLandParams{
+			Number:      stringToNullInt32(i.Number),
+			LandType:    stringToNullString(i.Type),
+			Description: stringToNullString(i.Description),
+			Acres:       stringToNullFloat64(i.Acres),
+			SquareFeet:  stringToNullFloat64(i.Sqft),
+			EffFront:    stringToNullFloat64(i.EffFront),
+			EffDepth:    stringToNullFloat64(i.EffDepth),
+			MarketValue: stringToNullInt32(i.MarketValue),
+			PropertyID:  stringToNullInt32(pr.PropertyID),
+			TaxYear:     year,
+		}
+		if err := q.InsertLand(ctx, landParams); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertImprovements(ctx context.Context, q *pgdb.Queries, pr tax.PropertyRecord, year sql.NullInt32) error {
+
+	for _, i := range pr.Improvements {
+		params := pgdb.InsertImprovementParams{
+			Name:        stringToNullString(i.Name),
+			Description: stringToNullString(i.Description),
+			StateCode:   stringToNullString(i.StateCode),
+			LivingArea:  stringToNullFloat64(i.LivingArea),
+			Value:       stringToNullFloat64(i.Value),
+			PropertyID:  stringToNullInt32(pr.PropertyID),
+			TaxYear:     year,
+		}
+
+		id, err := q.InsertImprovement(ctx, params)
+		if err != nil {
+			return err
+		}
+
+		for _, d := range i.Details {
+			paramDetails := pgdb.InsertImprovementDetailParams{
+				ImprovementID:   sql.NullInt32{Int32: id, Valid: true},
+				ImprovementType: stringToNullString(d.Type),
+				Description:     stringToNullString(d.Description),
+				Class:           stringToNullString(d.Class),
+				ExteriorWall:    stringToNullString(d.ExteriorWall),
+				YearBuilt:       stringToNullInt32(d.YearBuilt),
+				SquareFeet:      stringToNullInt32(d.SqFt),
+			}
+
+			if err := q.InsertImprovementDetail(ctx, paramDetails); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func insertJurisdictions(ctx context.Context, q *pgdb.Queries, pr tax.PropertyRecord, year sql.NullInt32) error {
+	for _, j := range pr.Jurisdictions {
+
+		params := pgdb.InsertJurisdictionParams{
+			Entity:         sql.NullString{},
+			Description:    sql.NullString{},
+			TaxRate:        stringToNullInt32(j.TaxRate),
+			AppraisedValue: stringToNullInt32(j.AppraisedValue),
+			TaxableValue:   stringToNullInt32(j.TaxableValue),
+			EstimatedTax:   stringToNullInt32(j.EstimatedTax),
+			PropertyID:     stringToNullInt32(pr.PropertyID),
+			TaxYear:        year,
+		}
+
+		if err := q.InsertJurisdiction(ctx, params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func upsertRollValues(ctx context.Context, q *pgdb.Queries, pr tax.PropertyRecord) error {
+	for _, r := range pr.RollValue {
+
+		rollParams := pgdb.UpsertRollValueParams{
+			Year:         stringToNullInt32(r.Year),
+			Improvements: stringToNullInt32(r.Improvements),
+			LandMarket:   stringToNullInt32(r.LandMarket),
+			AgValuation:  stringToNullInt32(r.AgValuation),
+			Appraised:    stringToNullInt32(r.Appraised),
+			HomesteadCap: stringToNullInt32(r.HomesteadCap),
+			Assessed:     stringToNullInt32(r.Assessed),
+			PropertyID:   stringToNullInt32(pr.PropertyID),
+		}
+
+		if err := q.UpsertRollValue(ctx, rollParams); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upsertPropertyRecord keeps the properties row on the latest tax year seen,
+// so backfilling an older year leaves it alone. A row with no tax year, from
+// before rows carried one, is only replaced by a default-year fetch.
+func upsertPropertyRecord(ctx context.Context, q *pgdb.Queries, pr tax.PropertyRecord, year sql.NullInt32, defaultYear bool) error {
+	propParams := pgdb.UpsertPropertyRecordParams{
+		ID:                  stringToInt32(pr.PropertyID),
+		Zoning:              stringToNullString(pr.Zoning),
+		NeighborhoodCd:      stringToNullString(pr.NeighborhoodCD),
+		Neighborhood:        stringToNullString(pr.Neighborhood),
+		Address:             stringToNullString(pr.Address),
+		LegalDescription:    stringToNullString(pr.LegalDescription),
+		GeographicID:        stringToNullString(pr.GeographicID),
+		Exemptions:          stringToNullString(pr.Exemptions),
+		OwnershipPercentage: stringToNullString(pr.OwnershipPercentage),
+		MapscoMapID:         stringToNullString(pr.MapscoMapID),
+		TaxYear:             year,
+		DefaultYear:         defaultYear,
+	}
+	return q.UpsertPropertyRecord(ctx, propParams)
+}
+
+// upsertPropertyTaxYear keeps the fields that change from one tax year to the
+// next, such as exemptions, for every year we have scraped.
+func upsertPropertyTaxYear(ctx context.Context, q *pgdb.Queries, pr tax.PropertyRecord, propertyID, year sql.NullInt32) error {
+	return q.UpsertPropertyTaxYear(ctx, pgdb.UpsertPropertyTaxYearParams{
+		PropertyID:          propertyID.Int32,
+		TaxYear:             year.Int32,
+		Zoning:              stringToNullString(pr.Zoning),
+		LegalDescription:    stringToNullString(pr.LegalDescription),
+		Exemptions:          stringToNullString(pr.Exemptions),
+		OwnershipPercentage: stringToNullString(pr.OwnershipPercentage),
+	})
+}
@@ -0,0 +1,266 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	_ "github.com/lib/pq"
+
+	"github.com/jason-costello/taxcollector/tax"
+)
+
+// ownerStatement matches the ALTER ... OWNER TO statements the migrations
+// carry from the database they were dumped from.
+var ownerStatement = regexp.MustCompile(`(?m)^ALTER [^;]* OWNER TO [^;]*;`)
+
+// openTestDB creates a database with every migration applied on the Postgres
+// server at TAXCOLLECTOR_TEST_DSN, a postgres:// url, and drops it when the
+// test ends. Without the variable the test is skipped.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TAXCOLLECTOR_TEST_DSN")
+	if dsn == "" {
+		t.Skip("TAXCOLLECTOR_TEST_DSN not set")
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	name := fmt.Sprintf("taxcollector_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("create database " + name); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Exec("drop database if exists " + name + " with (force)") })
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Path = "/" + name
+	db, err := sql.Open("postgres", u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	files, err := filepath.Glob("../storage/pgdb/migrations/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(ownerStatement.ReplaceAllString(string(b), "")); err != nil {
+			t.Fatalf("%s: %v", filepath.Base(f), err)
+		}
+	}
+	return db
+}
+
+func loadRecord(t *testing.T, propertyID string) tax.PropertyRecord {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("../test_data", propertyID+".html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, err := tax.GetPropertyRecord(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pr
+}
+
+func count(t *testing.T, db *sql.DB, query string, args ...interface{}) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return n
+}
+
+func saveBatch(t *testing.T, st *PGStore, records ...Record) []SaveResult {
+	t.Helper()
+	results, err := st.SaveBatch(context.Background(), records)
+	if err != nil {
+		t.Fatalf("SaveBatch() = %v", err)
+	}
+	return results
+}
+
+func TestPGStore_SaveBatchReplacesChildRows(t *testing.T) {
+	db := openTestDB(t)
+	st := NewPGStore(db)
+	pr := loadRecord(t, "2163")
+
+	saveBatch(t, st, Record{Property: pr})
+	// A changed page is written again, and must replace the year's child rows
+	// rather than add to them.
+	pr.Improvements[0].Value = "1"
+	saveBatch(t, st, Record{Property: pr})
+
+	tables := map[string]int{
+		"improvements":  len(pr.Improvements),
+		"jurisdictions": len(pr.Jurisdictions),
+		"land":          len(pr.Land),
+		"roll_values":   len(pr.RollValue),
+	}
+	for table, want := range tables {
+		if n := count(t, db, "select count(*) from "+table+" where property_id = 2163"); n != want {
+			t.Errorf("%s has %d rows after two saves, want %d", table, n, want)
+		}
+	}
+	if n := count(t, db, "select count(*) from properties where id = 2163"); n != 1 {
+		t.Errorf("properties has %d rows for 2163, want 1", n)
+	}
+}
+
+func TestPGStore_SaveBatchReplacesUntaggedRows(t *testing.T) {
+	db := openTestDB(t)
+	st := NewPGStore(db)
+	pr := loadRecord(t, "2163")
+
+	// Rows written before child rows carried their tax year.
+	if _, err := db.Exec("insert into properties (id) values (2163)"); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"improvements", "jurisdictions", "land"} {
+		if _, err := db.Exec("insert into " + table + " (property_id) values (2163)"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saveBatch(t, st, Record{Property: pr})
+
+	for _, table := range []string{"improvements", "jurisdictions", "land"} {
+		if n := count(t, db, "select count(*) from "+table+" where property_id = 2163 and tax_year is null"); n != 0 {
+			t.Errorf("%s kept %d untagged rows", table, n)
+		}
+	}
+}
+
+func TestPGStore_SaveBatchRollsBackFailedRecord(t *testing.T) {
+	db := openTestDB(t)
+	st := NewPGStore(db)
+	good, other := loadRecord(t, "2163"), loadRecord(t, "114173")
+	bad := good
+	bad.PropertyID = "999"
+	bad.Zoning = strings.Repeat("x", 300)
+
+	results := saveBatch(t, st,
+		Record{Property: good, URL: "https://example.com/2163"},
+		Record{Property: bad, URL: "https://example.com/999"},
+		Record{Property: other, URL: "https://example.com/114173"},
+	)
+
+	if results[0].Err != nil || results[2].Err != nil {
+		t.Errorf("good records failed: %v, %v", results[0].Err, results[2].Err)
+	}
+	if results[1].Err == nil {
+		t.Error("record with a zoning too long for its column saved")
+	}
+	if n := count(t, db, "select count(*) from properties where id in (2163, 114173)"); n != 2 {
+		t.Errorf("%d of the good records saved, want 2", n)
+	}
+	for _, table := range []string{"properties", "improvements", "land", "property_snapshots"} {
+		col := "property_id"
+		if table == "properties" {
+			col = "id"
+		}
+		if n := count(t, db, "select count(*) from "+table+" where "+col+" = 999"); n != 0 {
+			t.Errorf("failed record left %d rows in %s", n, table)
+		}
+	}
+}
+
+func TestPGStore_SaveBatchSnapshots(t *testing.T) {
+	db := openTestDB(t)
+	st := NewPGStore(db)
+	pr := loadRecord(t, "2163")
+
+	if r := saveBatch(t, st, Record{Property: pr})[0]; !r.Changed {
+		t.Error("first save of a property reported unchanged")
+	}
+
+	// The same page again must not open a new snapshot.
+	if r := saveBatch(t, st, Record{Property: pr})[0]; r.Changed || r.Err != nil {
+		t.Errorf("save of an unchanged page = %+v, want unchanged", r)
+	}
+	if n := count(t, db, "select count(*) from property_snapshots where property_id = 2163"); n != 1 {
+		t.Errorf("%d snapshots after saving the same page twice, want 1", n)
+	}
+
+	// A changed page closes the current snapshot and opens another.
+	pr.Exemptions = "changed"
+	if r := saveBatch(t, st, Record{Property: pr})[0]; !r.Changed || r.Err != nil {
+		t.Errorf("save of a changed page = %+v, want changed", r)
+	}
+	if n := count(t, db, "select count(*) from property_snapshots where property_id = 2163"); n != 2 {
+		t.Errorf("%d snapshots after a change, want 2", n)
+	}
+	if n := count(t, db, "select count(*) from property_snapshots where property_id = 2163 and valid_to is null"); n != 1 {
+		t.Errorf("%d current snapshots, want 1", n)
+	}
+	if n := count(t, db, "select count(*) from property_snapshots where property_id = 2163 and valid_to is null and record->>'exemptions' = 'changed'"); n != 1 {
+		t.Error("current snapshot is not the changed page")
+	}
+}
+
+func TestPGStore_SaveBatchKeepsUntaggedPropertyFromBackfill(t *testing.T) {
+	db := openTestDB(t)
+	st := NewPGStore(db)
+
+	// A properties row written before it carried its tax year.
+	if _, err := db.Exec("insert into properties (id, address) values (2163, 'current address')"); err != nil {
+		t.Fatal(err)
+	}
+	old := loadRecord(t, "2163")
+	old.TaxYear, old.Address = "2008", "2008 address"
+	saveBatch(t, st, Record{Property: old, TaxYear: 2008})
+
+	if n := count(t, db, "select count(*) from properties where id = 2163 and address = 'current address' and tax_year is null"); n != 1 {
+		t.Error("backfilling 2008 replaced a properties row with no tax year")
+	}
+
+	current := loadRecord(t, "2163")
+	saveBatch(t, st, Record{Property: current})
+	if n := count(t, db, "select count(*) from properties where id = 2163 and address = $1 and tax_year = $2", current.Address, current.TaxYear); n != 1 {
+		t.Error("a default-year fetch did not replace a properties row with no tax year")
+	}
+}
+
+func TestMigration_backfillsPropertyTaxYear(t *testing.T) {
+	db := openTestDB(t)
+	if _, err := db.Exec(`insert into properties (id) values (2163);
+		insert into roll_values (property_id, year) values (2163, 2020), (2163, 2021)`); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile("../storage/pgdb/migrations/000043_properties_tax_year_backfill.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(string(b)); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, db, "select count(*) from properties where id = 2163 and tax_year = 2021"); n != 1 {
+		t.Error("migration did not set tax_year from the latest roll value year")
+	}
+}
@@ -0,0 +1,359 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jason-costello/taxcollector/tax"
+)
+
+type StageStats struct {
+	Jobs int
+	Busy time.Duration
+	Max  time.Duration
+}
+
+func (s StageStats) Mean() time.Duration {
+	if s.Jobs == 0 {
+		return 0
+	}
+	return s.Busy / time.Duration(s.Jobs)
+}
+
+func (s StageStats) String() string {
+	return fmt.Sprintf("jobs: %d  busy: %s  mean: %s  max: %s",
+		s.Jobs, s.Busy.Round(time.Millisecond), s.Mean().Round(time.Millisecond), s.Max.Round(time.Millisecond))
+}
+
+func (s *StageStats) add(o StageStats) {
+	s.Jobs += o.Jobs
+	s.Busy += o.Busy
+	if o.Max > s.Max {
+		s.Max = o.Max
+	}
+}
+
+type stageTimer struct {
+	mu    sync.Mutex
+	stats StageStats
+}
+
+func (t *stageTimer) observe(start time.Time, jobs int) {
+	d := time.Since(start)
+	t.mu.Lock()
+	t.stats.Jobs += jobs
+	t.stats.Busy += d
+	if d > t.stats.Max {
+		t.stats.Max = d
+	}
+	t.mu.Unlock()
+}
+
+func (t *stageTimer) snapshot() StageStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stats
+}
+
+type Result struct {
+	Total        int
+	Succeeded    int
+	Failed       int
+	DeadLettered int
+	Unchanged    int
+	Retries      int
+	Unstarted    int
+	Duration     time.Duration
+	Fetch        StageStats
+	Parse        StageStats
+	Persist      StageStats
+	Err          error
+}
+
+// add folds the counts and stage stats of another run into r. Duration is
+// left for the caller, who knows how long the runs took end to end.
+func (r *Result) add(o Result) {
+	r.Total += o.Total
+	r.Succeeded += o.Succeeded
+	r.Failed += o.Failed
+	r.DeadLettered += o.DeadLettered
+	r.Unchanged += o.Unchanged
+	r.Retries += o.Retries
+	r.Unstarted += o.Unstarted
+	r.Fetch.add(o.Fetch)
+	r.Parse.add(o.Parse)
+	r.Persist.add(o.Persist)
+	if o.Err != nil {
+		r.Err = o.Err
+	}
+}
+
+func (r Result) String() string {
+	s := fmt.Sprintf("total: %d  succeeded: %d  failed: %d  dead-lettered: %d  unchanged: %d  retries: %d  unstarted: %d  duration: %s",
+		r.Total, r.Succeeded, r.Failed, r.DeadLettered, r.Unchanged, r.Retries, r.Unstarted, r.Duration.Round(time.Millisecond))
+	s += "\n  fetch:   " + r.Fetch.String()
+	s += "\n  parse:   " + r.Parse.String()
+	s += "\n  persist: " + r.Persist.String()
+	if r.Err != nil {
+		s += "\n  error: " + r.Err.Error()
+	}
+	return s
+}
+
+// pipeline wires the fetch, parse and persist stages together. Each stage has
+// its own pool of goroutines and hands work on through a bounded channel, so
+// a slow stage fills the channel in front of it and holds back the stages
+// upstream instead of letting work pile up in memory. Every job leaves the
+// pipeline exactly once on results, whichever stage it finished in.
+type pipeline struct {
+	fetchIn   chan Job
+	parseIn   chan Job
+	persistIn chan Job
+	results   chan Job
+
+	fetchTimer   stageTimer
+	parseTimer   stageTimer
+	persistTimer stageTimer
+
+	fetchWG   sync.WaitGroup
+	parseWG   sync.WaitGroup
+	persistWG sync.WaitGroup
+}
+
+func (s *Scraper) startPipeline(ctx context.Context) *pipeline {
+	p := &pipeline{
+		fetchIn:   make(chan Job),
+		parseIn:   make(chan Job, s.cfg.StageBuffer),
+		persistIn: make(chan Job, s.cfg.StageBuffer),
+		results:   make(chan Job),
+	}
+
+	p.fetchWG.Add(s.cfg.FetchWorkers)
+	for i := 1; i <= s.cfg.FetchWorkers; i++ {
+		go func(id int) {
+			defer p.fetchWG.Done()
+			for j := range p.fetchIn {
+				j.ProcessorID = id
+				start := time.Now()
+				s.fetch(ctx, &j)
+				p.fetchTimer.observe(start, 1)
+				if j.Error != nil {
+					p.results <- j
+					continue
+				}
+				p.parseIn <- j
+			}
+		}(i)
+	}
+	go func() {
+		p.fetchWG.Wait()
+		close(p.parseIn)
+	}()
+
+	p.parseWG.Add(s.cfg.ParseWorkers)
+	for i := 0; i < s.cfg.ParseWorkers; i++ {
+		go func() {
+			defer p.parseWG.Done()
+			for j := range p.parseIn {
+				start := time.Now()
+				s.parse(ctx, &j)
+				p.parseTimer.observe(start, 1)
+				if j.Error != nil {
+					p.results <- j
+					continue
+				}
+				p.persistIn <- j
+			}
+		}()
+	}
+	go func() {
+		p.parseWG.Wait()
+		close(p.persistIn)
+	}()
+
+	p.persistWG.Add(s.cfg.PersistWorkers)
+	for i := 0; i < s.cfg.PersistWorkers; i++ {
+		go func() {
+			defer p.persistWG.Done()
+			s.runPersister(ctx, p)
+		}()
+	}
+
+	return p
+}
+
+// runPersister collects parsed jobs into batches of Config.PersistBatch and
+// writes a batch when it is full, when Config.PersistFlush has passed since
+// the last write, or when the stage is shutting down.
+func (s *Scraper) runPersister(ctx context.Context, p *pipeline) {
+	ticker := time.NewTicker(s.cfg.PersistFlush)
+	defer ticker.Stop()
+
+	batch := make([]Job, 0, s.cfg.PersistBatch)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		start := time.Now()
+		s.persist(ctx, batch)
+		p.persistTimer.observe(start, len(batch))
+		for _, j := range batch {
+			p.results <- j
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case j, ok := <-p.persistIn:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, j)
+			if len(batch) >= s.cfg.PersistBatch {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// stop closes the pipeline's intake and waits for every stage to drain. It
+// must only be called once no jobs are left in flight.
+func (p *pipeline) stop() {
+	close(p.fetchIn)
+	p.fetchWG.Wait()
+	p.parseWG.Wait()
+	p.persistWG.Wait()
+}
+
+// Scrape pulls URLs from q in batches of Config.BatchSize whenever fewer jobs
+// than fetch workers are waiting, and returns once q is exhausted and every
+// job has finished. After ctx is cancelled no more jobs are started, and the
+// jobs already in the pipeline are given Config.ShutdownGrace before their own
+// requests are cancelled too. Jobs that fail for good are moved to the
+// dead-letter table; URLs that were never started, or that failed and could
+// not be dead-lettered, are released back to q.
+func (s *Scraper) Scrape(ctx context.Context, q Queue) Result {
+	start := time.Now()
+
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+	go func() {
+		select {
+		case <-ctx.Done():
+			t := time.NewTimer(s.cfg.ShutdownGrace)
+			defer t.Stop()
+			select {
+			case <-t.C:
+				cancelWork()
+			case <-workCtx.Done():
+			}
+		case <-workCtx.Done():
+		}
+	}()
+
+	p := s.startPipeline(workCtx)
+
+	var result Result
+	var queue []Job
+	var release []string
+	exhausted := false
+	done := ctx.Done()
+	inFlight := 0
+	nextJobID := 0
+
+	for {
+		if !exhausted && ctx.Err() == nil && len(queue) < s.cfg.FetchWorkers {
+			urls, err := q.Next(ctx, s.cfg.BatchSize)
+			if err != nil {
+				result.Err = err
+				fmt.Fprintf(s.cfg.Log, "queue: error fetching next batch, no more jobs will be started: %s\n", err)
+			}
+			if err != nil || len(urls) == 0 {
+				exhausted = true
+			}
+			for _, u := range urls {
+				propID := propertyIDFromURL(u)
+				if propID == "" {
+					continue
+				}
+				queue = append(queue, Job{
+					JobID:          nextJobID,
+					URL:            u,
+					TaxYear:        taxYearFromURL(u),
+					PropertyRecord: tax.PropertyRecord{PropertyID: propID},
+				})
+				nextJobID++
+				result.Total++
+			}
+		}
+		if len(queue) == 0 && inFlight == 0 && exhausted {
+			break
+		}
+
+		var send chan Job
+		var next Job
+		if len(queue) > 0 {
+			send = p.fetchIn
+			next = queue[0]
+		}
+
+		select {
+		case send <- next:
+			queue = queue[1:]
+			inFlight++
+		case r := <-p.results:
+			inFlight--
+			switch {
+			case r.Requeue && r.Attempts < s.cfg.MaxAttempts && ctx.Err() == nil:
+				fmt.Fprintf(s.cfg.Log, "worker: %d   job: %d propertyID: %s  requeued after attempt %d: %s\n", r.ProcessorID, r.JobID, r.PropertyRecord.PropertyID, r.Attempts, r.Error)
+				result.Retries++
+				queue = append(queue, r.retry())
+			case r.Error != nil:
+				result.Failed++
+				fmt.Fprintf(s.cfg.Log, "worker: %d   job: %d propertyID: %s  final error: %s\n", r.ProcessorID, r.JobID, r.PropertyRecord.PropertyID, r.Error)
+				if !s.deadLetterable(ctx, r) {
+					release = append(release, r.URL)
+					break
+				}
+				if err := s.deadLetter(ctx, r); err != nil {
+					fmt.Fprintf(s.cfg.Log, "worker: %d   job: %d propertyID: %s  error dead-lettering: %s\n", r.ProcessorID, r.JobID, r.PropertyRecord.PropertyID, err)
+					release = append(release, r.URL)
+					break
+				}
+				result.DeadLettered++
+			case r.Unchanged:
+				result.Unchanged++
+			default:
+				result.Succeeded++
+			}
+		case <-done:
+			fmt.Fprintf(s.cfg.Log, "shutting down: waiting on %d in-flight jobs, %d not started\n", inFlight, len(queue))
+			result.Unstarted = len(queue)
+			for _, j := range queue {
+				release = append(release, j.URL)
+			}
+			queue = nil
+			exhausted = true
+			done = nil
+		}
+	}
+	p.stop()
+
+	releaseCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := q.Release(releaseCtx, release); err != nil {
+		fmt.Fprintf(s.cfg.Log, "queue: error releasing %d urls: %s\n", len(release), err)
+	}
+
+	result.Fetch = p.fetchTimer.snapshot()
+	result.Parse = p.parseTimer.snapshot()
+	result.Persist = p.persistTimer.snapshot()
+	result.Duration = time.Since(start)
+	return result
+}
@@ -0,0 +1,105 @@
+package scraper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jason-costello/taxcollector/storage/pgdb"
+)
+
+// Queue hands Scrape URLs in batches as workers free up. URLs handed out by
+// Next are not handed out again until they are released or their claim
+// expires.
+type Queue interface {
+	Next(ctx context.Context, n int) ([]string, error)
+	Release(ctx context.Context, urls []string) error
+}
+
+type Ordering string
+
+const (
+	OrderRandom   Ordering = "random"
+	OrderOldest   Ordering = "oldest"
+	OrderPriority Ordering = "priority"
+)
+
+func ParseOrdering(s string) (Ordering, error) {
+	switch o := Ordering(s); o {
+	case OrderRandom, OrderOldest, OrderPriority:
+		return o, nil
+	case "":
+		return OrderRandom, nil
+	default:
+		return "", fmt.Errorf("unknown ordering %q: want random, oldest or priority", s)
+	}
+}
+
+// PendingQueue claims batches from pending_urls. Claims older than claimTTL
+// are treated as abandoned by a run that died and are handed out again.
+type PendingQueue struct {
+	pdb      *pgdb.Queries
+	order    Ordering
+	claimTTL time.Duration
+}
+
+func NewPendingQueue(db *sql.DB, order Ordering, claimTTL time.Duration) *PendingQueue {
+	if claimTTL <= 0 {
+		claimTTL = time.Hour
+	}
+	return &PendingQueue{
+		pdb:      pgdb.New(db),
+		order:    order,
+		claimTTL: claimTTL,
+	}
+}
+
+func (q *PendingQueue) Next(ctx context.Context, n int) ([]string, error) {
+	expired := sql.NullTime{Time: time.Now().Add(-q.claimTTL), Valid: true}
+
+	switch q.order {
+	case OrderOldest:
+		return q.pdb.ClaimPendingURLsOldest(ctx, pgdb.ClaimPendingURLsOldestParams{ClaimedAt: expired, Limit: int32(n)})
+	case OrderPriority:
+		return q.pdb.ClaimPendingURLsPriority(ctx, pgdb.ClaimPendingURLsPriorityParams{ClaimedAt: expired, Limit: int32(n)})
+	default:
+		return q.pdb.ClaimPendingURLsRandom(ctx, pgdb.ClaimPendingURLsRandomParams{ClaimedAt: expired, Limit: int32(n)})
+	}
+}
+
+func (q *PendingQueue) Release(ctx context.Context, urls []string) error {
+	for _, u := range urls {
+		if err := q.pdb.ReleasePendingURL(ctx, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SliceQueue serves a fixed list of URLs held in memory.
+type SliceQueue struct {
+	mu   sync.Mutex
+	urls []string
+}
+
+func NewSliceQueue(urls []string) *SliceQueue {
+	return &SliceQueue{urls: urls}
+}
+
+func (q *SliceQueue) Next(ctx context.Context, n int) ([]string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if n > len(q.urls) {
+		n = len(q.urls)
+	}
+	batch := q.urls[:n]
+	q.urls = q.urls[n:]
+	return batch, nil
+}
+
+func (q *SliceQueue) Release(ctx context.Context, urls []string) error {
+	return nil
+}
@@ -0,0 +1,121 @@
+package scraper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/jason-costello/taxcollector/storage/pgdb"
+)
+
+func enqueue(t *testing.T, db *sql.DB, priorities map[string]int32) {
+	t.Helper()
+	pdb := pgdb.New(db)
+	for u, p := range priorities {
+		if err := pdb.EnqueuePendingURL(context.Background(), pgdb.EnqueuePendingURLParams{Url: u, Priority: p}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPendingQueue_concurrentClaimers(t *testing.T) {
+	db := openTestDB(t)
+	urls := make(map[string]int32)
+	for i := 0; i < 100; i++ {
+		urls[fmt.Sprintf("https://example.test/clientdb/Property.aspx?cid=56&prop_id=%d", i)] = 0
+	}
+	enqueue(t, db, urls)
+
+	for _, order := range []Ordering{OrderRandom, OrderOldest, OrderPriority} {
+		t.Run(string(order), func(t *testing.T) {
+			if _, err := db.Exec("update pending_urls set claimed_at = null"); err != nil {
+				t.Fatal(err)
+			}
+			q := NewPendingQueue(db, order, 0)
+
+			var (
+				mu      sync.Mutex
+				claimed = make(map[string]int)
+				wg      sync.WaitGroup
+			)
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for {
+						batch, err := q.Next(context.Background(), 7)
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						if len(batch) == 0 {
+							return
+						}
+						mu.Lock()
+						for _, u := range batch {
+							claimed[u]++
+						}
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+
+			if len(claimed) != len(urls) {
+				t.Errorf("claimed %d of %d urls", len(claimed), len(urls))
+			}
+			for u, n := range claimed {
+				if n != 1 {
+					t.Errorf("%s claimed %d times", u, n)
+				}
+			}
+		})
+	}
+}
+
+func TestPendingQueue_Release(t *testing.T) {
+	db := openTestDB(t)
+	enqueue(t, db, map[string]int32{"a": 0, "b": 0})
+	q := NewPendingQueue(db, OrderOldest, 0)
+	ctx := context.Background()
+
+	if batch, err := q.Next(ctx, 10); err != nil || len(batch) != 2 {
+		t.Fatalf("Next() = %q, %v, want both urls", batch, err)
+	}
+	if batch, err := q.Next(ctx, 10); err != nil || len(batch) != 0 {
+		t.Fatalf("Next() = %q, %v, want nothing while both are claimed", batch, err)
+	}
+
+	if err := q.Release(ctx, []string{"b"}); err != nil {
+		t.Fatal(err)
+	}
+	if batch, err := q.Next(ctx, 10); err != nil || len(batch) != 1 || batch[0] != "b" {
+		t.Errorf("Next() after Release = %q, %v, want [b]", batch, err)
+	}
+
+	// A claim older than the TTL belongs to a run that died.
+	if _, err := db.Exec("update pending_urls set claimed_at = now() - interval '2 hours' where url = 'a'"); err != nil {
+		t.Fatal(err)
+	}
+	if batch, err := q.Next(ctx, 10); err != nil || len(batch) != 1 || batch[0] != "a" {
+		t.Errorf("Next() with an expired claim = %q, %v, want [a]", batch, err)
+	}
+}
+
+func TestPendingQueue_priority(t *testing.T) {
+	db := openTestDB(t)
+	enqueue(t, db, map[string]int32{"low": 0, "high": 10, "mid": 5})
+	q := NewPendingQueue(db, OrderPriority, 0)
+
+	batch, err := q.Next(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(batch)
+	if len(batch) != 2 || batch[0] != "high" || batch[1] != "mid" {
+		t.Errorf("Next(2) = %q, want the two highest priorities", batch)
+	}
+}
@@ -0,0 +1,229 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type Outcome int
+
+const (
+	OutcomeOK Outcome = iota
+	OutcomeError
+	OutcomeThrottled
+)
+
+// Limiter spaces requests with a global token bucket shared by every worker
+// and a token bucket per proxy. The global rate is steered by an AIMD
+// controller: throttling halves it, a run of mostly clean responses nudges
+// it back up. A Retry-After from the site parks the proxy it was sent to.
+type Limiter struct {
+	global     *rate.Limiter
+	proxyRate  rate.Limit
+	proxyBurst int
+	aimd       *aimd
+
+	mu         sync.Mutex
+	proxies    map[string]*rate.Limiter
+	retryAfter map[string]time.Time
+}
+
+func NewLimiter(cfg Config) *Limiter {
+	cfg = cfg.withDefaults()
+	return &Limiter{
+		global:     rate.NewLimiter(rate.Limit(cfg.Rate), cfg.Burst),
+		proxyRate:  rate.Limit(cfg.ProxyRate),
+		proxyBurst: cfg.ProxyBurst,
+		aimd: &aimd{
+			rate:     cfg.Rate,
+			min:      cfg.MinRate,
+			max:      cfg.MaxRate,
+			step:     cfg.RateStep,
+			factor:   0.5,
+			window:   20,
+			maxErr:   0.05,
+			cooldown: 5 * time.Second,
+		},
+		proxies:    make(map[string]*rate.Limiter),
+		retryAfter: make(map[string]time.Time),
+	}
+}
+
+func (l *Limiter) Rate() float64 {
+	return float64(l.global.Limit())
+}
+
+// waitError is a wait on the limiter cut short by its context, including a
+// wait that would outlast the context's deadline. The request it held back
+// was never sent, so the error says nothing about the site or the proxy.
+type waitError struct {
+	err error
+}
+
+func (e *waitError) Error() string { return "rate limiter: " + e.err.Error() }
+
+func (e *waitError) Unwrap() error { return e.err }
+
+// isWaitError reports whether err is from waiting on the limiter rather than
+// from a request.
+func isWaitError(err error) bool {
+	var we *waitError
+	return errors.As(err, &we)
+}
+
+// Wait blocks until a request may go out on the proxy identified by key.
+// Waits can run long when the rate is low, so ctx should not carry a
+// per-request timeout.
+func (l *Limiter) Wait(ctx context.Context, key string) error {
+	l.mu.Lock()
+	until := l.retryAfter[key]
+	pl, ok := l.proxies[key]
+	if !ok {
+		pl = rate.NewLimiter(l.proxyRate, l.proxyBurst)
+		l.proxies[key] = pl
+	}
+	l.mu.Unlock()
+
+	if d := time.Until(until); d > 0 {
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return &waitError{ctx.Err()}
+		case <-t.C:
+		}
+	}
+
+	if err := pl.Wait(ctx); err != nil {
+		return &waitError{err}
+	}
+	if err := l.global.Wait(ctx); err != nil {
+		return &waitError{err}
+	}
+	return nil
+}
+
+// Report feeds the result of a request back into the controller.
+func (l *Limiter) Report(key string, outcome Outcome, retryAfter time.Duration) {
+	if retryAfter > 0 {
+		l.mu.Lock()
+		until := time.Now().Add(retryAfter)
+		if until.After(l.retryAfter[key]) {
+			l.retryAfter[key] = until
+		}
+		l.mu.Unlock()
+	}
+
+	if r, changed := l.aimd.observe(outcome); changed {
+		l.global.SetLimit(rate.Limit(r))
+	}
+}
+
+type aimd struct {
+	mu       sync.Mutex
+	rate     float64
+	min      float64
+	max      float64
+	step     float64
+	factor   float64
+	window   int
+	maxErr   float64
+	cooldown time.Duration
+
+	total        int
+	failed       int
+	lastDecrease time.Time
+}
+
+func (a *aimd) observe(o Outcome) (float64, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if o == OutcomeThrottled {
+		a.total, a.failed = 0, 0
+		// Workers in flight when the site pushes back all see the same
+		// throttle, so only the first one within the cooldown counts.
+		if time.Since(a.lastDecrease) < a.cooldown {
+			return a.rate, false
+		}
+		a.lastDecrease = time.Now()
+		return a.set(a.rate * a.factor)
+	}
+
+	a.total++
+	if o == OutcomeError {
+		a.failed++
+	}
+	if a.total < a.window {
+		return a.rate, false
+	}
+
+	errRate := float64(a.failed) / float64(a.total)
+	a.total, a.failed = 0, 0
+	if errRate > a.maxErr {
+		return a.rate, false
+	}
+	return a.set(a.rate + a.step)
+}
+
+func (a *aimd) set(r float64) (float64, bool) {
+	if r < a.min {
+		r = a.min
+	}
+	if r > a.max {
+		r = a.max
+	}
+	changed := r != a.rate
+	a.rate = r
+	return r, changed
+}
+
+func outcomeFor(status int, kind PageKind, err error) Outcome {
+	if err != nil {
+		if isTimeout(err) {
+			return OutcomeThrottled
+		}
+		return OutcomeError
+	}
+	switch {
+	case status == http.StatusTooManyRequests, status == http.StatusServiceUnavailable, kind == PageRateLimited:
+		return OutcomeThrottled
+	case kind == PageDetail:
+		return OutcomeOK
+	default:
+		return OutcomeError
+	}
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// parseRetryAfter understands both forms of the header: a number of seconds
+// or an HTTP date.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
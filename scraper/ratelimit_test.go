@@ -0,0 +1,66 @@
+package scraper
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func Test_parseRetryAfter(t *testing.T) {
+	now := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		in   string
+		want time.Duration
+	}{
+		{"empty", "", 0},
+		{"seconds", "120", 2 * time.Minute},
+		{"negative", "-5", 0},
+		{"http date", now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{"date in past", now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"garbage", "soon", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.in, now); got != tt.want {
+				t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_aimd(t *testing.T) {
+	a := &aimd{rate: 2, min: 0.5, max: 3, step: 0.5, factor: 0.5, window: 4, maxErr: 0.25, cooldown: time.Hour}
+
+	for i := 0; i < 4; i++ {
+		a.observe(OutcomeOK)
+	}
+	if a.rate != 2.5 {
+		t.Fatalf("rate after clean window = %v, want 2.5", a.rate)
+	}
+
+	a.observe(OutcomeError)
+	a.observe(OutcomeError)
+	a.observe(OutcomeOK)
+	a.observe(OutcomeOK)
+	if a.rate != 2.5 {
+		t.Fatalf("rate after noisy window = %v, want 2.5", a.rate)
+	}
+
+	a.observe(OutcomeThrottled)
+	if a.rate != 1.25 {
+		t.Fatalf("rate after throttle = %v, want 1.25", a.rate)
+	}
+	a.observe(OutcomeThrottled)
+	if a.rate != 1.25 {
+		t.Fatalf("second throttle within cooldown changed rate to %v", a.rate)
+	}
+
+	a.lastDecrease = time.Time{}
+	a.observe(OutcomeThrottled)
+	a.lastDecrease = time.Time{}
+	a.observe(OutcomeThrottled)
+	if a.rate != 0.5 {
+		t.Fatalf("rate = %v, want floor of 0.5", a.rate)
+	}
+}
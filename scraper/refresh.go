@@ -0,0 +1,127 @@
+package scraper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jason-costello/taxcollector/storage/pgdb"
+)
+
+// refreshPriority ranks refreshes below urls that have never been scraped
+// when pending urls are worked in priority order.
+const refreshPriority = -1
+
+// sourceDater is implemented by fetchers that can read the date the county
+// last updated its database off the live site.
+type sourceDater interface {
+	SourceUpdatedAt(ctx context.Context) (time.Time, error)
+}
+
+// Refresh revisits properties we already hold. Every Config.RefreshTick it
+// enqueues the properties that have gone unfetched for longer than
+// Config.RefreshMaxAge, or whose county database has been updated since we
+// last fetched them, then scrapes q until it is drained. The county's last
+// update is read off the site once a round when the fetcher can, so an update
+// is noticed on the next round rather than once some property happens to be
+// refetched. The number enqueued each round is paced so the whole county is
+// revisited once per Config.RefreshWindow instead of all at once. It runs
+// until ctx is cancelled and returns the totals across every round.
+func (s *Scraper) Refresh(ctx context.Context, q Queue) Result {
+	start := time.Now()
+	var total Result
+	last := time.Now().Add(-s.cfg.RefreshTick)
+
+	for {
+		now := time.Now()
+		n, err := s.scheduleRefresh(ctx, now.Sub(last))
+		if err != nil {
+			fmt.Fprintf(s.cfg.Log, "refresh: error scheduling refreshes: %s\n", err)
+		} else {
+			fmt.Fprintf(s.cfg.Log, "refresh: enqueued %d properties\n", n)
+		}
+		last = now
+
+		total.add(s.Scrape(ctx, q))
+		if ctx.Err() != nil {
+			break
+		}
+
+		t := time.NewTimer(time.Until(last.Add(s.cfg.RefreshTick)))
+		select {
+		case <-ctx.Done():
+		case <-t.C:
+		}
+		t.Stop()
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	total.Duration = time.Since(start)
+	return total
+}
+
+// scheduleRefresh enqueues the share of the county due in the time elapsed
+// since the last round, oldest fetches first.
+func (s *Scraper) scheduleRefresh(ctx context.Context, elapsed time.Duration) (int, error) {
+	count, err := s.pdb.CountProperties(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("CountProperties: %w", err)
+	}
+	quota := refreshQuota(count, elapsed, s.cfg.RefreshWindow)
+	if quota == 0 {
+		return 0, nil
+	}
+
+	ids, err := s.pdb.ListPropertiesDueForRefresh(ctx, pgdb.ListPropertiesDueForRefreshParams{
+		LastFetchedAt:   sql.NullTime{Time: time.Now().Add(-s.cfg.RefreshMaxAge), Valid: true},
+		SourceUpdatedAt: s.sourceUpdatedAt(ctx),
+		Limit:           int32(quota),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("ListPropertiesDueForRefresh: %w", err)
+	}
+
+	for i, id := range ids {
+		if err := s.pdb.EnqueuePendingURL(ctx, pgdb.EnqueuePendingURLParams{Url: s.cfg.detailURL(id), Priority: refreshPriority}); err != nil {
+			return i, fmt.Errorf("EnqueuePendingURL: %w", err)
+		}
+	}
+	return len(ids), nil
+}
+
+// sourceUpdatedAt is the county's last update as the site shows it now, or
+// null when the fetcher cannot tell, leaving the query to go by the stored
+// dates.
+func (s *Scraper) sourceUpdatedAt(ctx context.Context) sql.NullTime {
+	sd, ok := s.fetcher.(sourceDater)
+	if !ok {
+		return sql.NullTime{}
+	}
+	t, err := sd.SourceUpdatedAt(ctx)
+	if err != nil {
+		fmt.Fprintf(s.cfg.Log, "refresh: error reading county database date: %s\n", err)
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// refreshQuota is the number of properties out of total to revisit in elapsed
+// so that all of them are revisited once per window. It rounds up, so a
+// county smaller than the number of rounds in a window is still refreshed.
+func refreshQuota(total int64, elapsed, window time.Duration) int {
+	if total <= 0 || elapsed <= 0 || window <= 0 {
+		return 0
+	}
+	if elapsed >= window {
+		elapsed = window
+	}
+	q := math.Ceil(float64(total) * float64(elapsed) / float64(window))
+	if q > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return int(q)
+}
@@ -0,0 +1,69 @@
+package scraper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jason-costello/taxcollector/storage/pgdb"
+)
+
+func Test_refreshQuota(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		name    string
+		total   int64
+		elapsed time.Duration
+		window  time.Duration
+		want    int
+	}{
+		{"empty county", 0, time.Minute, day, 0},
+		{"one minute of a day", 144000, time.Minute, day, 100},
+		{"rounds up", 10, time.Minute, day, 1},
+		{"overran the window", 500, 2 * day, day, 500},
+		{"no time elapsed", 500, 0, day, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := refreshQuota(tt.total, tt.elapsed, tt.window); got != tt.want {
+				t.Errorf("refreshQuota(%d, %s, %s) = %d, want %d", tt.total, tt.elapsed, tt.window, got, tt.want)
+			}
+		})
+	}
+}
+
+type sourceDate time.Time
+
+func (d sourceDate) Fetch(ctx context.Context, j *Job) error { return nil }
+
+func (d sourceDate) SourceUpdatedAt(ctx context.Context) (time.Time, error) {
+	return time.Time(d), nil
+}
+
+func TestScraper_scheduleRefreshOnSourceUpdate(t *testing.T) {
+	db := openTestDB(t)
+	// Fetched an hour ago, well inside RefreshMaxAge, from the county's
+	// database as of April 30th.
+	if _, err := db.Exec(`insert into properties (id, last_fetched_at, source_updated_at)
+		values (2163, now() - interval '1 hour', '2022-04-30 22:46:00+00')`); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		site time.Time
+		want int
+	}{
+		{time.Date(2022, 4, 30, 22, 46, 0, 0, time.UTC), 0},
+		{time.Date(2022, 5, 7, 22, 0, 0, 0, time.UTC), 1},
+	} {
+		s := &Scraper{
+			cfg:     Config{RefreshWindow: time.Hour}.withDefaults(),
+			pdb:     pgdb.New(db),
+			fetcher: sourceDate(tt.site),
+		}
+		n, err := s.scheduleRefresh(context.Background(), time.Hour)
+		if err != nil || n != tt.want {
+			t.Errorf("with the site updated %s, scheduleRefresh() = %d, %v, want %d", tt.site, n, err, tt.want)
+		}
+	}
+}
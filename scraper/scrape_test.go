@@ -0,0 +1,301 @@
+package scraper
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jason-costello/taxcollector/proxies"
+	"github.com/jason-costello/taxcollector/scraper/scrapertest"
+	"github.com/jason-costello/taxcollector/storage/pgdb"
+	"github.com/jason-costello/taxcollector/tax"
+	"github.com/jason-costello/taxcollector/useragents"
+)
+
+// memorySink stands in for Postgres, keeping the last record saved for each
+// property.
+type memorySink struct {
+	mu      sync.Mutex
+	records map[string]tax.PropertyRecord
+}
+
+func (m *memorySink) SaveBatch(ctx context.Context, records []Record) ([]SaveResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	results := make([]SaveResult, len(records))
+	for i, r := range records {
+		m.records[r.Property.PropertyID] = r.Property
+		results[i].Changed = true
+	}
+	return results, nil
+}
+
+const testUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+func newTestScraper(t *testing.T, srv *scrapertest.Server, cfg Config) (*Scraper, *memorySink) {
+	t.Helper()
+
+	sink := &memorySink{records: make(map[string]tax.PropertyRecord)}
+	cfg.BaseURL = srv.URL
+	cfg.Sink = sink
+	cfg.Rate, cfg.MaxRate, cfg.ProxyRate = 1000, 1000, 1000
+	cfg.Burst, cfg.ProxyBurst = 10, 10
+	cfg.PersistFlush = 10 * time.Millisecond
+	if cfg.FetchWorkers == 0 {
+		cfg.FetchWorkers = 2
+	}
+	return NewScraper(nil, testUserAgents(), nil, nil, cfg), sink
+}
+
+// testUserAgents sends every request as testUserAgent.
+func testUserAgents() *useragents.UserAgentClient {
+	return useragents.NewUserAgentClient([]useragents.Agent{{UserAgent: testUserAgent, Share: 1}})
+}
+
+func newTestServer(t *testing.T) *scrapertest.Server {
+	t.Helper()
+	srv, err := scrapertest.NewServer("../test_data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func detailURLs(srv *scrapertest.Server, ids ...string) []string {
+	urls := make([]string, len(ids))
+	for i, id := range ids {
+		urls[i] = srv.URL + "/clientdb/Property.aspx?cid=56&prop_id=" + id
+	}
+	return urls
+}
+
+// releaseRecorder notes the URLs Scrape hands back to the queue.
+type releaseRecorder struct {
+	Queue
+	released []string
+}
+
+func (q *releaseRecorder) Release(ctx context.Context, urls []string) error {
+	q.released = append(q.released, urls...)
+	return q.Queue.Release(ctx, urls)
+}
+
+func TestScrape(t *testing.T) {
+	srv := newTestServer(t)
+	s, sink := newTestScraper(t, srv, Config{})
+
+	result := s.Scrape(context.Background(), NewSliceQueue(detailURLs(srv, "2163", "114173")))
+
+	if result.Total != 2 || result.Succeeded != 2 || result.Failed != 0 {
+		t.Fatalf("Scrape() = %s", result)
+	}
+	if pr, ok := sink.records["2163"]; !ok || pr.TaxYear != "2022" || len(pr.Improvements) == 0 {
+		t.Errorf("record for 2163 = %+v", pr)
+	}
+	if _, ok := sink.records["114173"]; !ok {
+		t.Error("no record saved for 114173")
+	}
+	if n := srv.Bootstraps(); n != 1 {
+		t.Errorf("bootstrapped %d sessions, want the one session to be reused", n)
+	}
+	if agents := srv.UserAgents(); len(agents) != 1 || agents[testUserAgent] != 3 {
+		t.Errorf("requests by user agent = %v, want the landing page and both details as %q", agents, testUserAgent)
+	}
+}
+
+func TestScrapeRetriesTransientFaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		faults []scrapertest.Fault
+		hits   int
+	}{
+		{"rate limited", []scrapertest.Fault{scrapertest.RateLimit}, 2},
+		{"dropped connection", []scrapertest.Fault{scrapertest.Drop}, 2},
+		{"truncated body", []scrapertest.Fault{scrapertest.Truncate}, 2},
+		{"captcha then rate limited", []scrapertest.Fault{scrapertest.Captcha, scrapertest.RateLimit}, 3},
+		{"slow", []scrapertest.Fault{scrapertest.Slow}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t)
+			srv.SlowDelay = 50 * time.Millisecond
+			srv.Fail("2163", tt.faults...)
+			s, sink := newTestScraper(t, srv, Config{})
+
+			result := s.Scrape(context.Background(), NewSliceQueue(detailURLs(srv, "2163")))
+
+			if result.Succeeded != 1 {
+				t.Fatalf("Scrape() = %s", result)
+			}
+			if _, ok := sink.records["2163"]; !ok {
+				t.Error("no record saved")
+			}
+			if n := srv.Hits("2163"); n != tt.hits {
+				t.Errorf("%d detail requests, want %d", n, tt.hits)
+			}
+		})
+	}
+}
+
+// batchSink records the size of each batch handed to the persist stage.
+type batchSink struct {
+	*memorySink
+	sizes []int
+}
+
+func (b *batchSink) SaveBatch(ctx context.Context, records []Record) ([]SaveResult, error) {
+	b.mu.Lock()
+	b.sizes = append(b.sizes, len(records))
+	b.mu.Unlock()
+	return b.memorySink.SaveBatch(ctx, records)
+}
+
+func TestScrapeStages(t *testing.T) {
+	srv := newTestServer(t)
+	srv.Fail("2163", scrapertest.RateLimit)
+	s, mem := newTestScraper(t, srv, Config{PersistBatch: 2})
+	sink := &batchSink{memorySink: mem}
+	s.sink = sink
+	s.cfg.PersistFlush = time.Hour
+
+	result := s.Scrape(context.Background(), NewSliceQueue(detailURLs(srv, "2163", "114173")))
+
+	if result.Succeeded != 2 || result.Retries != 1 {
+		t.Fatalf("Scrape() = %s", result)
+	}
+	// The rate limited fetch goes back through the fetch stage alone.
+	if result.Fetch.Jobs != 3 || result.Parse.Jobs != 2 || result.Persist.Jobs != 2 {
+		t.Errorf("stage jobs: fetch %d, parse %d, persist %d, want 3, 2, 2", result.Fetch.Jobs, result.Parse.Jobs, result.Persist.Jobs)
+	}
+	if len(sink.sizes) != 1 || sink.sizes[0] != 2 {
+		t.Errorf("persisted batches of %v, want one batch of 2", sink.sizes)
+	}
+}
+
+func TestScrapeGivesUpAfterMaxAttempts(t *testing.T) {
+	srv := newTestServer(t)
+	srv.Fail("2163", scrapertest.Captcha, scrapertest.Captcha, scrapertest.Captcha, scrapertest.Captcha)
+	s, sink := newTestScraper(t, srv, Config{MaxAttempts: 3})
+
+	result := s.Scrape(context.Background(), NewSliceQueue(detailURLs(srv, "2163", "114173")))
+
+	if result.Failed != 1 || result.Succeeded != 1 || result.Retries != 2 {
+		t.Fatalf("Scrape() = %s", result)
+	}
+	if srv.Hits("2163") != 3 {
+		t.Errorf("%d detail requests for 2163, want 3", srv.Hits("2163"))
+	}
+	if _, ok := sink.records["2163"]; ok {
+		t.Error("saved a record for a property that never loaded")
+	}
+}
+
+func TestScrapeRebootstrapsExpiredSession(t *testing.T) {
+	srv := newTestServer(t)
+	srv.Fail("2163", scrapertest.ExpireSession)
+	s, _ := newTestScraper(t, srv, Config{FetchWorkers: 1})
+
+	result := s.Scrape(context.Background(), NewSliceQueue(detailURLs(srv, "2163")))
+
+	if result.Succeeded != 1 || result.Retries != 0 {
+		t.Fatalf("Scrape() = %s", result)
+	}
+	// The redirect to the landing page hands out a session of its own before
+	// the scraper notices and bootstraps a fresh one.
+	if n := srv.Bootstraps(); n != 3 {
+		t.Errorf("bootstrapped %d sessions, want 3", n)
+	}
+}
+
+func TestScrapeRebuildsPostbackOnLostSession(t *testing.T) {
+	srv := newTestServer(t)
+	srv.FailPostback("2163", scrapertest.ExpireSession)
+	s, sink := newTestScraper(t, srv, Config{FetchWorkers: 1})
+
+	result := s.Scrape(context.Background(), NewSliceQueue([]string{detailURLs(srv, "2163")[0] + "&year=2015"}))
+
+	if result.Succeeded != 1 || result.Retries != 0 {
+		t.Fatalf("Scrape() = %s", result)
+	}
+	if pr := sink.records["2163"]; pr.TaxYear != "2015" {
+		t.Errorf("saved tax year %q, want 2015", pr.TaxYear)
+	}
+	// The page, the postback that loses the session, then the page again and
+	// a postback built from it on the new session.
+	if n := srv.Hits("2163"); n != 4 {
+		t.Errorf("made %d detail requests, want 4", n)
+	}
+}
+
+func TestScrapeMissingProperty(t *testing.T) {
+	srv := newTestServer(t)
+	s, _ := newTestScraper(t, srv, Config{MaxAttempts: 2})
+
+	result := s.Scrape(context.Background(), NewSliceQueue(detailURLs(srv, "1")))
+
+	if result.Failed != 1 || result.Succeeded != 0 {
+		t.Fatalf("Scrape() = %s", result)
+	}
+}
+
+func TestScrapeShutdown(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SlowDelay = 5 * time.Second
+	srv.Fail("2163", scrapertest.Slow)
+	srv.Fail("114173", scrapertest.Slow)
+	s, sink := newTestScraper(t, srv, Config{FetchWorkers: 1, ShutdownGrace: 10 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	urls := detailURLs(srv, "2163", "114173")
+	q := &releaseRecorder{Queue: NewSliceQueue(urls)}
+	start := time.Now()
+	result := s.Scrape(ctx, q)
+
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("Scrape() took %s to shut down", time.Since(start))
+	}
+	if result.Succeeded != 0 || result.Unstarted != 1 || result.Failed != 1 {
+		t.Errorf("Scrape() = %s", result)
+	}
+	if len(sink.records) != 0 {
+		t.Errorf("saved %d records", len(sink.records))
+	}
+	// The cancelled job and the one never started both go back to the queue.
+	if len(q.released) != 2 || q.released[0] != urls[1] || q.released[1] != urls[0] {
+		t.Errorf("released %q, want %q then %q", q.released, urls[1], urls[0])
+	}
+}
+
+func TestScrapeWaitsForProxies(t *testing.T) {
+	db := openTestDB(t)
+	srv := newTestServer(t)
+	ctx := context.Background()
+
+	// The pool's only proxy is cooling down, so nothing is in rotation.
+	pc := proxies.NewProxyClient(db)
+	if _, err := pgdb.New(db).InsertProxy(ctx, pgdb.InsertProxyParams{Ip: "10.0.0.1:8080", Scheme: "http"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pc.MarkProxyAsBad(ctx, "10.0.0.1:8080"); err != nil {
+		t.Fatal(err)
+	}
+
+	s, sink := newTestScraper(t, srv, Config{ProxyMode: ProxyModePool, MaxAttempts: 1, ShutdownGrace: 50 * time.Millisecond})
+	s.fetcher = NewHTTPFetcher(pc, testUserAgents(), nil, s.cfg)
+	s.db, s.pdb = db, pgdb.New(db)
+
+	ctx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	result := s.Scrape(ctx, NewSliceQueue(detailURLs(srv, "2163", "114173")))
+
+	if result.DeadLettered != 0 || count(t, db, "select count(*) from dead_letters") != 0 {
+		t.Errorf("Scrape() = %s, want jobs waiting on a proxy released rather than dead-lettered", result)
+	}
+	if srv.Hits("2163") != 0 || len(sink.records) != 0 {
+		t.Errorf("made %d requests and saved %d records with no proxy in rotation", srv.Hits("2163"), len(sink.records))
+	}
+}
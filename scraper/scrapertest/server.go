@@ -0,0 +1,289 @@
+// Package scrapertest runs a local stand-in for the TrueAutomation site, so the
+// scraper can be tested end to end without the network.
+package scrapertest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const sessionCookie = "ASP.NET_SessionId"
+
+// Fault is something the server does to a detail request instead of serving
+// the page.
+type Fault int
+
+const (
+	// Slow serves the page after Server.SlowDelay.
+	Slow Fault = iota + 1
+	// RateLimit answers 429 Too Many Requests.
+	RateLimit
+	// Captcha answers 200 with a captcha challenge.
+	Captcha
+	// Drop closes the connection without answering.
+	Drop
+	// ExpireSession forgets the request's session and bounces it back to the
+	// landing page, as the site does when an ASP.NET session times out.
+	ExpireSession
+	// Truncate sends the page's headers and half its body, then closes the
+	// connection.
+	Truncate
+)
+
+const (
+	captchaPage = `<html><head><title>Security check</title></head><body><div class="g-recaptcha"></div></body></html>`
+	landingPage = `<html><head><title>Property Search</title></head><body><form action="PropertySearch.aspx?cid=56"></form>%s</body></html>`
+	footer      = `<div id="footer"><table><tr><td align="center">Database last updated on: %s</td></tr></table></div>`
+	searchPage  = `<html><head><title>Property Search Results</title></head><body><form action="SearchResults.aspx?cid=56"></form></body></html>`
+	errorPage   = `<html><head><title>Runtime Error</title></head><body><h1>Server Error in '/' Application.</h1></body></html>`
+)
+
+// Server fakes the landing page, search results and property detail pages.
+// Detail pages are served from fixtures named <propertyID>.html, and only to
+// clients holding a session cookie from the landing page. Posting the year
+// selector back serves the same page with the posted year selected. Faults
+// queued with Fail are applied to a property's detail requests in order, one
+// per request, before its page is served normally; those queued with
+// FailPostback are applied to its year postbacks alone.
+type Server struct {
+	*httptest.Server
+
+	SlowDelay time.Duration
+	// SourceUpdated is the county database date shown in the landing page's
+	// footer, which has none when it is zero.
+	SourceUpdated time.Time
+
+	mu         sync.Mutex
+	pages      map[string][]byte
+	faults     map[string][]Fault
+	postFaults map[string][]Fault
+	hits       map[string]int
+	sessions   map[string]bool
+	bootstraps int
+	agents     map[string]int
+}
+
+// NewServer starts a server serving every .html file in dir as a detail page.
+func NewServer(dir string) (*Server, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		SlowDelay:  200 * time.Millisecond,
+		pages:      make(map[string][]byte),
+		faults:     make(map[string][]Fault),
+		postFaults: make(map[string][]Fault),
+		hits:       make(map[string]int),
+		sessions:   make(map[string]bool),
+		agents:     make(map[string]int),
+	}
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		s.pages[strings.TrimSuffix(filepath.Base(f), ".html")] = b
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/clientdb/", s.landing)
+	mux.HandleFunc("/clientdb/SearchResults.aspx", s.search)
+	mux.HandleFunc("/clientdb/Property.aspx", s.detail)
+	s.Server = httptest.NewServer(s.countAgent(mux))
+	return s, nil
+}
+
+// Fail queues faults for the property's next detail requests.
+func (s *Server) Fail(propertyID string, faults ...Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[propertyID] = append(s.faults[propertyID], faults...)
+}
+
+// FailPostback queues faults for the property's next year postbacks.
+func (s *Server) FailPostback(propertyID string, faults ...Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.postFaults[propertyID] = append(s.postFaults[propertyID], faults...)
+}
+
+// Hits is the number of detail requests made for the property, postbacks
+// included, faulted or not.
+func (s *Server) Hits(propertyID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[propertyID]
+}
+
+// Bootstraps is the number of sessions handed out by the landing page.
+func (s *Server) Bootstraps() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bootstraps
+}
+
+// UserAgents is the number of requests made with each User-Agent header, the
+// landing page included.
+func (s *Server) UserAgents() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	agents := make(map[string]int, len(s.agents))
+	for ua, n := range s.agents {
+		agents[ua] = n
+	}
+	return agents
+}
+
+func (s *Server) countAgent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.agents[r.UserAgent()]++
+		s.mu.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) landing(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/clientdb/" {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.hasSession(r) {
+		b := make([]byte, 12)
+		rand.Read(b)
+		id := hex.EncodeToString(b)
+
+		s.mu.Lock()
+		s.sessions[id] = true
+		s.bootstraps++
+		s.mu.Unlock()
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: id, Path: "/"})
+	}
+	var foot string
+	if !s.SourceUpdated.IsZero() {
+		foot = fmt.Sprintf(footer, s.SourceUpdated.Format("1/2/2006 3:04 PM"))
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, landingPage, foot)
+}
+
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(searchPage))
+}
+
+func (s *Server) detail(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("prop_id")
+
+	s.mu.Lock()
+	s.hits[id]++
+	faults := s.faults
+	if r.Method == http.MethodPost {
+		faults = s.postFaults
+	}
+	var fault Fault
+	if q := faults[id]; len(q) > 0 {
+		fault, faults[id] = q[0], q[1:]
+	}
+	page, ok := s.pages[id]
+	s.mu.Unlock()
+
+	switch fault {
+	case Slow:
+		select {
+		case <-time.After(s.SlowDelay):
+		case <-r.Context().Done():
+			return
+		}
+	case RateLimit:
+		w.Header().Set("Retry-After", "0")
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		return
+	case Captcha:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(captchaPage))
+		return
+	case Drop:
+		if hj, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+		panic(http.ErrAbortHandler)
+	case ExpireSession:
+		if c, err := r.Cookie(sessionCookie); err == nil {
+			s.mu.Lock()
+			delete(s.sessions, c.Value)
+			s.mu.Unlock()
+		}
+	}
+
+	if !s.hasSession(r) {
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1})
+		http.Redirect(w, r, "/clientdb/?cid=56", http.StatusFound)
+		return
+	}
+	if !ok {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(errorPage))
+		return
+	}
+	if r.Method == http.MethodPost {
+		var err error
+		if page, err = postback(r, page); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if fault == Truncate {
+		w.Header().Set("Content-Length", strconv.Itoa(len(page)))
+		w.Write(page[:len(page)/2])
+		return
+	}
+	w.Write(page)
+}
+
+// postback answers a year selector postback with page showing the posted
+// year. A postback without the page's view state is refused, as ASP.NET
+// refuses one.
+func postback(r *http.Request, page []byte) ([]byte, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	if r.PostForm.Get("__VIEWSTATE") == "" {
+		return nil, errors.New("postback has no view state")
+	}
+	year := r.PostForm.Get("propertyHeading:taxyear")
+	option := []byte(`<option value="` + year + `"`)
+	if year == "" || !bytes.Contains(page, option) {
+		return nil, fmt.Errorf("postback for tax year %q the page does not offer", year)
+	}
+	page = bytes.Replace(page, []byte(`<option selected="selected" value=`), []byte(`<option value=`), -1)
+	return bytes.Replace(page, option, []byte(`<option selected="selected" value="`+year+`"`), 1), nil
+}
+
+func (s *Server) hasSession(r *http.Request) bool {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[c.Value]
+}
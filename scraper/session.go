@@ -0,0 +1,352 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+
+	"github.com/jason-costello/taxcollector/proxies"
+	"github.com/jason-costello/taxcollector/useragents"
+)
+
+var (
+	ErrSessionLost     = errors.New("session lost: redirected to landing or search page")
+	ErrNoSessionCookie = errors.New("landing page did not issue a session cookie")
+)
+
+// Session is a bootstrapped cookie jar bound to a single proxy. It is shared
+// by every worker using that proxy until it is used up, expires or is lost.
+// Every request it makes, from the landing page on, carries the headers of the
+// one browser profile it was started with.
+type Session struct {
+	key       string
+	client    *http.Client
+	createdAt time.Time
+	profile   useragents.Profile
+
+	mu      sync.Mutex
+	uses    int
+	referer string
+}
+
+// Profile is the browser profile the session's requests are sent as.
+func (s *Session) Profile() useragents.Profile {
+	return s.profile
+}
+
+func (s *Session) Uses() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.uses
+}
+
+func (s *Session) do(req *http.Request) (*http.Response, error) {
+	s.mu.Lock()
+	s.uses++
+	referer := s.referer
+	s.referer = req.URL.String()
+	s.mu.Unlock()
+
+	s.profile.Apply(req, referer)
+	return s.client.Do(req)
+}
+
+type SessionManager struct {
+	base     *http.Client
+	limiter  *Limiter
+	profiles *useragents.UserAgentClient
+	landing  string
+	search   string
+	maxUses  int
+	maxAge   time.Duration
+
+	mu            sync.Mutex
+	sessions      map[string]*Session
+	bootstrapping map[string]*sync.Mutex
+	// transports keeps one transport per proxy, shared by its successive
+	// sessions so their keep-alive connections are reused, not leaked.
+	transports map[string]*http.Transport
+}
+
+// NewSessionManager returns a manager whose sessions each take a random
+// browser profile from profiles. With a nil profiles requests are sent with
+// Go's default headers.
+func NewSessionManager(base *http.Client, limiter *Limiter, profiles *useragents.UserAgentClient, cfg Config) *SessionManager {
+	cfg = cfg.withDefaults()
+	if base == nil {
+		base = &http.Client{}
+	}
+	return &SessionManager{
+		base:          base,
+		limiter:       limiter,
+		profiles:      profiles,
+		landing:       cfg.landingURL(),
+		search:        cfg.searchURL(),
+		maxUses:       cfg.SessionMaxUses,
+		maxAge:        cfg.SessionMaxAge,
+		sessions:      make(map[string]*Session),
+		bootstrapping: make(map[string]*sync.Mutex),
+		transports:    make(map[string]*http.Transport),
+	}
+}
+
+// idleConnTimeout closes a proxy's keep-alive connections once they have sat
+// unused this long, as http.DefaultTransport does.
+const idleConnTimeout = 90 * time.Second
+
+// sessionKey names the address a request leaves from, for its session and
+// its per-proxy rate. Every direct request shares one key, since they all
+// come from this machine's address.
+func sessionKey(p proxies.Proxy) string {
+	if p.IP == "" {
+		return "direct"
+	}
+	return p.Addr()
+}
+
+func (m *SessionManager) expired(s *Session) bool {
+	return s.Uses() >= m.maxUses || time.Since(s.createdAt) > m.maxAge
+}
+
+// Get returns the live session for the proxy, bootstrapping a new one when
+// there is none or the current one has been used up or has expired. Workers
+// that find no session at the same time wait on one bootstrap rather than
+// each starting their own.
+func (m *SessionManager) Get(ctx context.Context, p proxies.Proxy) (*Session, error) {
+	key := sessionKey(p)
+	if s := m.live(key); s != nil {
+		return s, nil
+	}
+
+	m.mu.Lock()
+	kl, ok := m.bootstrapping[key]
+	if !ok {
+		kl = &sync.Mutex{}
+		m.bootstrapping[key] = kl
+	}
+	m.mu.Unlock()
+
+	kl.Lock()
+	defer kl.Unlock()
+	if s := m.live(key); s != nil {
+		return s, nil
+	}
+
+	m.mu.Lock()
+	delete(m.sessions, key)
+	m.mu.Unlock()
+
+	s, err := m.bootstrap(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.sessions[key] = s
+	m.mu.Unlock()
+	return s, nil
+}
+
+func (m *SessionManager) live(key string) *Session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.sessions[key]; ok && !m.expired(s) {
+		return s
+	}
+	return nil
+}
+
+// Invalidate drops the session so the next Get re-bootstraps. A session that
+// has already been replaced is left alone.
+func (m *SessionManager) Invalidate(s *Session) {
+	if s == nil {
+		return
+	}
+	m.mu.Lock()
+	if m.sessions[s.key] == s {
+		delete(m.sessions, s.key)
+	}
+	m.mu.Unlock()
+}
+
+// InvalidateProxy drops whatever session is held for the proxy, and closes
+// the proxy's idle connections.
+func (m *SessionManager) InvalidateProxy(p proxies.Proxy) {
+	m.mu.Lock()
+	delete(m.sessions, sessionKey(p))
+	t := m.transports[sessionKey(p)]
+	m.mu.Unlock()
+	if t != nil {
+		t.CloseIdleConnections()
+	}
+}
+
+// Do sends req through the proxy's session. When the site bounces the request
+// back to the landing or search page the session is dropped and the request
+// is retried once on a freshly bootstrapped session. A request with a body is
+// not retried: its body has been read, and a postback's form state belongs to
+// the lost session, so it fails with ErrSessionLost for the caller to rebuild.
+func (m *SessionManager) Do(ctx context.Context, p proxies.Proxy, req *http.Request) (*http.Response, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		s, err := m.Get(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := m.wait(ctx, s.key); err != nil {
+			return nil, err
+		}
+		resp, err := s.do(req.Clone(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		if !m.sessionLost(req, resp) {
+			return resp, nil
+		}
+		resp.Body.Close()
+		m.Invalidate(s)
+		if req.Body != nil && req.Body != http.NoBody {
+			break
+		}
+	}
+	return nil, ErrSessionLost
+}
+
+func (m *SessionManager) bootstrap(ctx context.Context, p proxies.Proxy) (*Session, error) {
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := m.transportFor(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var profile useragents.Profile
+	if m.profiles != nil {
+		if profile, err = m.profiles.GetRandomProfile(); err != nil {
+			return nil, fmt.Errorf("profiles.GetRandomProfile: %w", err)
+		}
+	}
+
+	s := &Session{
+		key: sessionKey(p),
+		client: &http.Client{
+			Transport:     transport,
+			Jar:           jar,
+			Timeout:       m.base.Timeout,
+			CheckRedirect: m.base.CheckRedirect,
+		},
+		profile: profile,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", m.landing, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.wait(ctx, s.key); err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode > 399 || resp.StatusCode < 200 {
+		return nil, fmt.Errorf("session bootstrap: %s", resp.Status)
+	}
+	if len(jar.Cookies(resp.Request.URL)) == 0 {
+		return nil, ErrNoSessionCookie
+	}
+
+	// The landing request is the browser arriving at the site, not a use of
+	// the session.
+	s.uses = 0
+	s.createdAt = time.Now()
+	return s, nil
+}
+
+func (m *SessionManager) wait(ctx context.Context, key string) error {
+	if m.limiter == nil {
+		return nil
+	}
+	return m.limiter.Wait(ctx, key)
+}
+
+// transportFor returns the transport for requests through p: the base
+// client's own for a direct connection, otherwise one per proxy cloned from
+// the base transport, or from http.DefaultTransport when the base has none of
+// its own, so it keeps their dial and TLS timeouts.
+func (m *SessionManager) transportFor(p proxies.Proxy) (http.RoundTripper, error) {
+	if p.IP == "" {
+		return m.base.Transport, nil
+	}
+
+	switch p.Scheme {
+	case "", "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("proxy %s: unsupported scheme %q", p.Addr(), p.Scheme)
+	}
+
+	key := sessionKey(p)
+	proxyURL := p.URL()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t, ok := m.transports[key]; ok {
+		// The same address may come back from the pool with new credentials
+		// or scheme after a re-import.
+		if u, err := t.Proxy(nil); err == nil && u.String() == proxyURL.String() {
+			return t, nil
+		}
+		t.CloseIdleConnections()
+	}
+
+	base, ok := m.base.Transport.(*http.Transport)
+	if !ok {
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	t := base.Clone()
+	t.Proxy = http.ProxyURL(proxyURL)
+	if t.IdleConnTimeout <= 0 {
+		t.IdleConnTimeout = idleConnTimeout
+	}
+	m.transports[key] = t
+	return t, nil
+}
+
+// sessionLost reports whether the site redirected a request away from the page
+// that was asked for and back to the landing or search page, which is what it
+// does once the ASP.NET session behind the cookie has gone away.
+func (m *SessionManager) sessionLost(req *http.Request, resp *http.Response) bool {
+	if resp.Request == nil || resp.Request.URL == nil {
+		return false
+	}
+	final := resp.Request.URL
+	if strings.EqualFold(final.Path, req.URL.Path) {
+		return false
+	}
+
+	for _, raw := range []string{m.landing, m.search} {
+		u, err := url.Parse(raw)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(final.Path, u.Path) {
+			return true
+		}
+	}
+	return strings.EqualFold(final.Path, "/clientdb/default.aspx")
+}
@@ -0,0 +1,210 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jason-costello/taxcollector/proxies"
+	"github.com/jason-costello/taxcollector/useragents"
+)
+
+func TestSessionManager_profile(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		seen []http.Header
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.Header.Clone())
+		mu.Unlock()
+		http.SetCookie(w, &http.Cookie{Name: "ASP.NET_SessionId", Value: "abc", Path: "/"})
+	}))
+	defer srv.Close()
+
+	cfg := Config{BaseURL: srv.URL}
+	m := NewSessionManager(nil, nil, testUserAgents(), cfg)
+	detail := cfg.withDefaults().detailURL(1)
+	req, _ := http.NewRequest("GET", detail, nil)
+	resp, err := m.Do(context.Background(), proxies.Proxy{}, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if len(seen) != 2 {
+		t.Fatalf("server saw %d requests, want the landing page and the detail", len(seen))
+	}
+	landing, page := seen[0], seen[1]
+	want := useragents.NewProfile(testUserAgent)
+	for name := range want.Headers {
+		if name == "Sec-Fetch-Site" {
+			continue
+		}
+		if v := want.Headers.Get(name); landing.Get(name) != v || page.Get(name) != v {
+			t.Errorf("%s: landing sent %q, detail sent %q, want %q", name, landing.Get(name), page.Get(name), v)
+		}
+	}
+	if landing.Get("Referer") != "" || landing.Get("Sec-Fetch-Site") != "none" {
+		t.Errorf("landing request came from %q, Sec-Fetch-Site %q", landing.Get("Referer"), landing.Get("Sec-Fetch-Site"))
+	}
+	if page.Get("Referer") != cfg.withDefaults().landingURL() || page.Get("Sec-Fetch-Site") != "same-origin" {
+		t.Errorf("detail request came from %q, Sec-Fetch-Site %q", page.Get("Referer"), page.Get("Sec-Fetch-Site"))
+	}
+}
+
+func TestSessionManager_Get(t *testing.T) {
+	srv := newTestServer(t)
+	m := NewSessionManager(nil, nil, nil, Config{BaseURL: srv.URL})
+
+	s, err := m.Get(context.Background(), proxies.Proxy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := m.Get(context.Background(), proxies.Proxy{}); err != nil || again != s {
+		t.Errorf("second Get() = %p, %v, want the live session %p", again, err, s)
+	}
+	if n := srv.Bootstraps(); n != 1 {
+		t.Errorf("bootstrapped %d sessions, want 1", n)
+	}
+	if s.Uses() != 0 {
+		t.Errorf("fresh session has %d uses, want the landing request not to count", s.Uses())
+	}
+
+	noCookie := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer noCookie.Close()
+	m = NewSessionManager(nil, nil, nil, Config{BaseURL: noCookie.URL})
+	if _, err := m.Get(context.Background(), proxies.Proxy{}); !errors.Is(err, ErrNoSessionCookie) {
+		t.Errorf("Get() from a landing page without a cookie = %v, want ErrNoSessionCookie", err)
+	}
+}
+
+func TestSessionManager_concurrentGet(t *testing.T) {
+	srv := newTestServer(t)
+	m := NewSessionManager(nil, nil, nil, Config{BaseURL: srv.URL})
+
+	sessions := make([]*Session, 8)
+	var wg sync.WaitGroup
+	for i := range sessions {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s, err := m.Get(context.Background(), proxies.Proxy{})
+			if err != nil {
+				t.Error(err)
+			}
+			sessions[i] = s
+		}(i)
+	}
+	wg.Wait()
+
+	for i, s := range sessions {
+		if s == nil || s != sessions[0] {
+			t.Errorf("worker %d got session %p, want the shared session %p", i, s, sessions[0])
+		}
+	}
+	if n := srv.Bootstraps(); n != 1 {
+		t.Errorf("bootstrapped %d sessions for %d workers, want 1", n, len(sessions))
+	}
+}
+
+func TestSessionManager_expiry(t *testing.T) {
+	srv := newTestServer(t)
+	m := NewSessionManager(nil, nil, nil, Config{BaseURL: srv.URL, SessionMaxUses: 2})
+
+	first, err := m.Get(context.Background(), proxies.Proxy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", detailURLs(srv, "2163")[0], nil)
+		resp, err := m.Do(context.Background(), proxies.Proxy{}, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	second, err := m.Get(context.Background(), proxies.Proxy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first {
+		t.Error("Get() handed out a session that had used up its requests")
+	}
+	if n := srv.Bootstraps(); n != 2 {
+		t.Errorf("bootstrapped %d sessions, want 2", n)
+	}
+
+	m.maxAge = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if third, err := m.Get(context.Background(), proxies.Proxy{}); err != nil || third == second {
+		t.Errorf("Get() = %p, %v, want a new session in place of the expired one", third, err)
+	}
+}
+
+func TestSessionManager_Invalidate(t *testing.T) {
+	srv := newTestServer(t)
+	m := NewSessionManager(nil, nil, nil, Config{BaseURL: srv.URL})
+
+	stale, err := m.Get(context.Background(), proxies.Proxy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Invalidate(stale)
+	fresh, err := m.Get(context.Background(), proxies.Proxy{})
+	if err != nil || fresh == stale {
+		t.Fatalf("Get() after Invalidate = %p, %v, want a new session", fresh, err)
+	}
+
+	// A worker still holding the old session must not drop its replacement.
+	m.Invalidate(stale)
+	if s, _ := m.Get(context.Background(), proxies.Proxy{}); s != fresh {
+		t.Error("invalidating a replaced session dropped its replacement")
+	}
+
+	m.InvalidateProxy(proxies.Proxy{})
+	if s, _ := m.Get(context.Background(), proxies.Proxy{}); s == fresh {
+		t.Error("InvalidateProxy() left the session in place")
+	}
+}
+
+func TestSessionManager_transportFor(t *testing.T) {
+	base := &http.Client{Transport: &http.Transport{TLSHandshakeTimeout: 3 * time.Second}}
+	m := NewSessionManager(base, nil, nil, Config{})
+
+	p := proxies.Proxy{IP: "10.0.0.1", Port: 8080}
+	rt, err := m.transportFor(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := rt.(*http.Transport)
+	if tr.TLSHandshakeTimeout != 3*time.Second || tr.IdleConnTimeout <= 0 {
+		t.Errorf("proxy transport has TLS handshake timeout %v and idle timeout %v, want the base's and a limit", tr.TLSHandshakeTimeout, tr.IdleConnTimeout)
+	}
+	if again, _ := m.transportFor(p); again != rt {
+		t.Error("a second session on the proxy got a transport of its own")
+	}
+
+	p.Username, p.Password = "bob", "s3cret"
+	if withAuth, _ := m.transportFor(p); withAuth == rt {
+		t.Error("transport kept after the proxy's credentials changed")
+	}
+	if other, _ := m.transportFor(proxies.Proxy{IP: "10.0.0.2", Port: 8080}); other == rt {
+		t.Error("two proxies share a transport")
+	}
+	if direct, _ := m.transportFor(proxies.Proxy{}); direct != base.Transport {
+		t.Error("direct connections do not use the base transport")
+	}
+
+	for scheme, ok := range map[string]bool{"socks5": true, "socks5h": false, "ftp": false} {
+		_, err := m.transportFor(proxies.Proxy{IP: "10.0.0.3", Port: 1080, Scheme: scheme})
+		if (err == nil) != ok {
+			t.Errorf("transportFor with scheme %s: error = %v, want ok %t", scheme, err, ok)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package scraper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const yearEventTarget = "propertyHeading$taxyear"
+
+var ErrYearNotOffered = errors.New("tax year is not offered for this property")
+
+// taxYearFromURL returns the year a detail url asks for, or 0 when it asks
+// for the default year.
+func taxYearFromURL(u string) int {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return 0
+	}
+	for k, v := range parsed.Query() {
+		if strings.EqualFold(k, "year") && len(v) > 0 {
+			y, err := strconv.Atoi(strings.TrimSpace(v[0]))
+			if err != nil || y < 0 {
+				return 0
+			}
+			return y
+		}
+	}
+	return 0
+}
+
+// yearSelector reads the tax year selector off a detail page: the year shown
+// and every year the page offers.
+func yearSelector(page []byte) (int, []int, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page))
+	if err != nil {
+		return 0, nil, err
+	}
+	var selected int
+	var offered []int
+	doc.Find("#propertyHeading_taxyear option").Each(func(_ int, o *goquery.Selection) {
+		y, err := strconv.Atoi(strings.TrimSpace(o.AttrOr("value", "")))
+		if err != nil {
+			return
+		}
+		offered = append(offered, y)
+		if _, ok := o.Attr("selected"); ok {
+			selected = y
+		}
+	})
+	return selected, offered, nil
+}
+
+// yearForm builds the postback the year selector makes when it is changed:
+// the page's form posted back to itself with its hidden ASP.NET state and the
+// new year. The returned action is resolved against pageURL.
+func yearForm(page []byte, pageURL *url.URL, year int) (string, url.Values, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page))
+	if err != nil {
+		return "", nil, err
+	}
+	form := doc.Find("form").First()
+	if form.Length() == 0 {
+		return "", nil, errors.New("detail page has no form")
+	}
+
+	action, err := pageURL.Parse(form.AttrOr("action", ""))
+	if err != nil {
+		return "", nil, fmt.Errorf("form action: %w", err)
+	}
+
+	values := url.Values{}
+	form.Find(`input[type="hidden"]`).Each(func(_ int, in *goquery.Selection) {
+		if name, ok := in.Attr("name"); ok {
+			values.Set(name, in.AttrOr("value", ""))
+		}
+	})
+	values.Set("__EVENTTARGET", yearEventTarget)
+	values.Set("__EVENTARGUMENT", "")
+	values.Set(form.Find("#propertyHeading_taxyear").AttrOr("name", "propertyHeading:taxyear"), strconv.Itoa(year))
+	return action.String(), values, nil
+}
+
+func offersYear(offered []int, year int) bool {
+	for _, y := range offered {
+		if y == year {
+			return true
+		}
+	}
+	return false
+}
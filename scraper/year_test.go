@@ -0,0 +1,83 @@
+package scraper
+
+import (
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jason-costello/taxcollector/tax"
+)
+
+func Test_taxYearFromURL(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"https://propaccess.trueautomation.com/clientdb/Property.aspx?cid=56&prop_id=2163", 0},
+		{"https://propaccess.trueautomation.com/clientdb/Property.aspx?cid=56&prop_id=2163&year=2015", 2015},
+		{"https://propaccess.trueautomation.com/clientdb/Property.aspx?cid=56&prop_id=2163&Year=2015", 2015},
+		{"https://propaccess.trueautomation.com/clientdb/Property.aspx?cid=56&prop_id=2163&year=last", 0},
+	}
+	for _, tt := range tests {
+		if got := taxYearFromURL(tt.in); got != tt.want {
+			t.Errorf("taxYearFromURL(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func Test_taxYear(t *testing.T) {
+	tests := []struct {
+		page  string
+		asked int
+		want  int32
+	}{
+		{"2015", 2015, 2015},
+		{"2022", 0, 2022},
+		{"", 2008, 2008},
+		{"", 0, int32(time.Now().Year())},
+	}
+	for _, tt := range tests {
+		if got := taxYear(tax.PropertyRecord{TaxYear: tt.page}, tt.asked); got.Int32 != tt.want || !got.Valid {
+			t.Errorf("taxYear(page %q, asked %d) = %v, want %d", tt.page, tt.asked, got, tt.want)
+		}
+	}
+}
+
+func Test_yearForm(t *testing.T) {
+	page, err := os.ReadFile("../test_data/2163.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	selected, offered, err := yearSelector(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if selected != 2022 {
+		t.Errorf("selected year = %d, want 2022", selected)
+	}
+	if !offersYear(offered, 2008) || offersYear(offered, 2007) {
+		t.Errorf("offered years = %v, want 2008 through 2022", offered)
+	}
+
+	pageURL, _ := url.Parse("https://propaccess.trueautomation.com/clientdb/Property.aspx?cid=56&prop_id=2163")
+	action, values, err := yearForm(page, pageURL, 2015)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action != "https://propaccess.trueautomation.com/clientdb/Property.aspx?cid=56&prop_id=2163" {
+		t.Errorf("action = %q", action)
+	}
+	if got := values.Get("propertyHeading:taxyear"); got != "2015" {
+		t.Errorf("year field = %q, want 2015", got)
+	}
+	if got := values.Get("__EVENTTARGET"); got != yearEventTarget {
+		t.Errorf("__EVENTTARGET = %q, want %q", got, yearEventTarget)
+	}
+	for _, k := range []string{"__VIEWSTATE", "__VIEWSTATEGENERATOR", "__EVENTVALIDATION"} {
+		if values.Get(k) == "" {
+			t.Errorf("%s not carried over from the page", k)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+DROP INDEX If Exists public.pending_urls_priority_index;
+DROP INDEX If Exists public.pending_urls_created_at_index;
+DROP INDEX If Exists public.pending_urls_sort_key_index;
+
+ALTER TABLE public.pending_urls
+    DROP COLUMN If Exists claimed_at,
+    DROP COLUMN If Exists sort_key,
+    DROP COLUMN If Exists priority,
+    DROP COLUMN If Exists created_at;
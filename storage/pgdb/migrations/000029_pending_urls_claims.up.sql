@@ -0,0 +1,11 @@
+ALTER TABLE public.pending_urls
+    ADD COLUMN created_at timestamp with time zone DEFAULT now() NOT NULL,
+    ADD COLUMN priority integer DEFAULT 0 NOT NULL,
+    ADD COLUMN sort_key double precision DEFAULT random() NOT NULL,
+    ADD COLUMN claimed_at timestamp with time zone;
+
+CREATE INDEX pending_urls_sort_key_index ON public.pending_urls USING btree (sort_key);
+
+CREATE INDEX pending_urls_created_at_index ON public.pending_urls USING btree (created_at);
+
+CREATE INDEX pending_urls_priority_index ON public.pending_urls USING btree (priority DESC, created_at);
@@ -0,0 +1,13 @@
+DROP INDEX If Exists public.roll_values_property_id_year_index;
+DROP INDEX If Exists public.land_property_id_tax_year_index;
+DROP INDEX If Exists public.jurisdictions_property_id_tax_year_index;
+DROP INDEX If Exists public.improvements_property_id_tax_year_index;
+
+ALTER TABLE public.land
+    DROP COLUMN If Exists tax_year;
+
+ALTER TABLE public.jurisdictions
+    DROP COLUMN If Exists tax_year;
+
+ALTER TABLE public.improvements
+    DROP COLUMN If Exists tax_year;
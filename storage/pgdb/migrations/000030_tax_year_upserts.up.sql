@@ -0,0 +1,22 @@
+ALTER TABLE public.improvements
+    ADD COLUMN tax_year integer;
+
+ALTER TABLE public.jurisdictions
+    ADD COLUMN tax_year integer;
+
+ALTER TABLE public.land
+    ADD COLUMN tax_year integer;
+
+CREATE INDEX improvements_property_id_tax_year_index ON public.improvements USING btree (property_id, tax_year);
+
+CREATE INDEX jurisdictions_property_id_tax_year_index ON public.jurisdictions USING btree (property_id, tax_year);
+
+CREATE INDEX land_property_id_tax_year_index ON public.land USING btree (property_id, tax_year);
+
+DELETE FROM public.roll_values a
+    USING public.roll_values b
+WHERE a.property_id = b.property_id
+  AND a.year = b.year
+  AND a.id < b.id;
+
+CREATE UNIQUE INDEX roll_values_property_id_year_index ON public.roll_values USING btree (property_id, year);
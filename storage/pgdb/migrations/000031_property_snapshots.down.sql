@@ -0,0 +1 @@
+DROP TABLE If Exists public.property_snapshots;
@@ -0,0 +1,41 @@
+CREATE TABLE public.property_snapshots (
+    id integer NOT NULL,
+    property_id integer NOT NULL,
+    tax_year integer NOT NULL,
+    content_hash text NOT NULL,
+    record jsonb NOT NULL,
+    valid_from timestamp with time zone DEFAULT now() NOT NULL,
+    valid_to timestamp with time zone
+);
+
+
+ALTER TABLE public.property_snapshots OWNER TO jc;
+
+
+CREATE SEQUENCE public.property_snapshots_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.property_snapshots_id_seq OWNER TO jc;
+
+
+ALTER SEQUENCE public.property_snapshots_id_seq OWNED BY public.property_snapshots.id;
+
+
+ALTER TABLE ONLY public.property_snapshots ALTER COLUMN id SET DEFAULT nextval('public.property_snapshots_id_seq'::regclass);
+
+
+ALTER TABLE ONLY public.property_snapshots
+    ADD CONSTRAINT property_snapshots_pk PRIMARY KEY (id);
+
+
+CREATE UNIQUE INDEX property_snapshots_current_index ON public.property_snapshots USING btree (property_id, tax_year) WHERE (valid_to IS NULL);
+
+
+
+CREATE INDEX property_snapshots_property_id_valid_from_index ON public.property_snapshots USING btree (property_id, tax_year, valid_from);
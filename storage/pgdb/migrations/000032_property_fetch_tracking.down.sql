@@ -0,0 +1,5 @@
+DROP INDEX If Exists public.properties_last_fetched_at_index;
+
+ALTER TABLE public.properties
+    DROP COLUMN If Exists source_updated_at,
+    DROP COLUMN If Exists last_fetched_at;
@@ -0,0 +1,5 @@
+ALTER TABLE public.properties
+    ADD COLUMN last_fetched_at timestamp with time zone,
+    ADD COLUMN source_updated_at timestamp with time zone;
+
+CREATE INDEX properties_last_fetched_at_index ON public.properties USING btree (last_fetched_at NULLS FIRST);
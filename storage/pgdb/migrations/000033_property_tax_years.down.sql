@@ -0,0 +1,4 @@
+DROP TABLE If Exists public.property_tax_years;
+
+ALTER TABLE public.properties
+    DROP COLUMN If Exists tax_year;
@@ -0,0 +1,20 @@
+ALTER TABLE public.properties
+    ADD COLUMN tax_year integer;
+
+CREATE TABLE public.property_tax_years (
+    property_id integer NOT NULL,
+    tax_year integer NOT NULL,
+    zoning character varying(255),
+    legal_description character varying(500),
+    exemptions character varying(255),
+    ownership_percentage numeric,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    updated_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+ALTER TABLE public.property_tax_years OWNER TO jc;
+
+
+ALTER TABLE ONLY public.property_tax_years
+    ADD CONSTRAINT property_tax_years_pk PRIMARY KEY (property_id, tax_year);
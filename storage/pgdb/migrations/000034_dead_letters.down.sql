@@ -0,0 +1 @@
+DROP TABLE If Exists public.dead_letters;
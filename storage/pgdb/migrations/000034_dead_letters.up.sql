@@ -0,0 +1,48 @@
+CREATE TABLE public.dead_letters (
+    id integer NOT NULL,
+    url text NOT NULL,
+    property_id integer,
+    tax_year integer,
+    attempts integer NOT NULL,
+    status integer,
+    headers jsonb DEFAULT '{}'::jsonb NOT NULL,
+    body bytea DEFAULT '\x'::bytea NOT NULL,
+    body_truncated boolean DEFAULT false NOT NULL,
+    proxy text DEFAULT ''::text NOT NULL,
+    user_agent text DEFAULT ''::text NOT NULL,
+    last_error text NOT NULL,
+    error_chain jsonb DEFAULT '[]'::jsonb NOT NULL,
+    failed_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+ALTER TABLE public.dead_letters OWNER TO jc;
+
+
+CREATE SEQUENCE public.dead_letters_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.dead_letters_id_seq OWNER TO jc;
+
+
+ALTER SEQUENCE public.dead_letters_id_seq OWNED BY public.dead_letters.id;
+
+
+ALTER TABLE ONLY public.dead_letters ALTER COLUMN id SET DEFAULT nextval('public.dead_letters_id_seq'::regclass);
+
+
+ALTER TABLE ONLY public.dead_letters
+    ADD CONSTRAINT dead_letters_pk PRIMARY KEY (id);
+
+
+CREATE UNIQUE INDEX dead_letters_url_index ON public.dead_letters USING btree (url);
+
+
+
+CREATE INDEX dead_letters_failed_at_index ON public.dead_letters USING btree (failed_at);
@@ -0,0 +1,8 @@
+UPDATE public.proxies SET is_bad = 1 WHERE failures > 0;
+
+ALTER TABLE public.proxies
+    DROP COLUMN If Exists last_error,
+    DROP COLUMN If Exists latency_ms,
+    DROP COLUMN If Exists last_checked_at,
+    DROP COLUMN If Exists cooldown_until,
+    DROP COLUMN If Exists failures;
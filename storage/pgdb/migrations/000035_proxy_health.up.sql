@@ -0,0 +1,13 @@
+ALTER TABLE public.proxies
+    ADD COLUMN failures integer DEFAULT 0 NOT NULL,
+    ADD COLUMN cooldown_until timestamp with time zone,
+    ADD COLUMN last_checked_at timestamp with time zone,
+    ADD COLUMN latency_ms integer,
+    ADD COLUMN last_error text;
+
+-- Proxies banned for good under the old scheme get a chance to pass a check.
+UPDATE public.proxies
+SET is_bad = 0, failures = 1, cooldown_until = now()
+WHERE is_bad <> 0;
+
+UPDATE public.proxies SET is_bad = 0 WHERE is_bad IS NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE public.proxies
+    DROP COLUMN If Exists password,
+    DROP COLUMN If Exists username,
+    DROP COLUMN If Exists scheme;
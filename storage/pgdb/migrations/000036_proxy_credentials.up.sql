@@ -0,0 +1,4 @@
+ALTER TABLE public.proxies
+    ADD COLUMN scheme text DEFAULT 'http'::text NOT NULL,
+    ADD COLUMN username text,
+    ADD COLUMN password text;
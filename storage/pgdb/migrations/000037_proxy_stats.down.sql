@@ -0,0 +1,6 @@
+ALTER TABLE public.proxies
+    DROP COLUMN If Exists median_latency_ms,
+    DROP COLUMN If Exists latencies_ms,
+    DROP COLUMN If Exists timeouts,
+    DROP COLUMN If Exists blocks,
+    DROP COLUMN If Exists successes;
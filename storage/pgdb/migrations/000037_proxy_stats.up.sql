@@ -0,0 +1,9 @@
+-- Outcome counts decay with every request a proxy makes, so they describe its
+-- recent behaviour rather than its whole history. latencies_ms keeps the last
+-- few successful request times for the median.
+ALTER TABLE public.proxies
+    ADD COLUMN successes double precision DEFAULT 0 NOT NULL,
+    ADD COLUMN blocks double precision DEFAULT 0 NOT NULL,
+    ADD COLUMN timeouts double precision DEFAULT 0 NOT NULL,
+    ADD COLUMN latencies_ms integer[] DEFAULT '{}'::integer[] NOT NULL,
+    ADD COLUMN median_latency_ms integer;
@@ -0,0 +1,3 @@
+ALTER TABLE public.proxies
+    DROP COLUMN If Exists lease_expires_at,
+    DROP COLUMN If Exists leases;
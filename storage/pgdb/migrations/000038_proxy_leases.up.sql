@@ -0,0 +1,6 @@
+-- leases counts the workers holding a proxy. A worker that dies holding one
+-- never releases it, so the count is only trusted until lease_expires_at,
+-- which every new lease pushes back.
+ALTER TABLE public.proxies
+    ADD COLUMN leases integer DEFAULT 0 NOT NULL,
+    ADD COLUMN lease_expires_at timestamp with time zone;
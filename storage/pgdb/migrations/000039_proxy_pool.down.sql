@@ -0,0 +1,7 @@
+DROP TRIGGER If Exists proxies_pool_changed ON public.proxies;
+DROP FUNCTION If Exists public.bump_proxy_pool_version();
+DROP TABLE If Exists public.proxy_pool_version;
+
+ALTER TABLE public.proxies
+    ADD COLUMN leases integer DEFAULT 0 NOT NULL,
+    ADD COLUMN lease_expires_at timestamp with time zone;
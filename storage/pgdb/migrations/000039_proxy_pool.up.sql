@@ -0,0 +1,30 @@
+-- Scrapers keep the pool in memory and hold leases there, so the lease
+-- columns go. They poll proxy_pool_version instead of the table and reload
+-- when it moves, which it does whenever proxies are added, removed, have
+-- their credentials changed or go in or out of rotation. Usage stats written
+-- back by the scrapers themselves leave it alone.
+ALTER TABLE public.proxies
+    DROP COLUMN If Exists lease_expires_at,
+    DROP COLUMN If Exists leases;
+
+CREATE TABLE public.proxy_pool_version (
+    id boolean DEFAULT true NOT NULL PRIMARY KEY CHECK (id),
+    version bigint DEFAULT 0 NOT NULL
+);
+
+INSERT INTO public.proxy_pool_version (id, version) VALUES (true, 0);
+
+CREATE FUNCTION public.bump_proxy_pool_version() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+    UPDATE public.proxy_pool_version SET version = version + 1;
+    RETURN NULL;
+END;
+$$;
+
+CREATE TRIGGER proxies_pool_changed
+    AFTER INSERT OR DELETE OR UPDATE OF ip, scheme, username, password, is_bad, failures
+    ON public.proxies
+    FOR EACH STATEMENT
+    EXECUTE FUNCTION public.bump_proxy_pool_version();
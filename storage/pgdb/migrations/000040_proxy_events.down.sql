@@ -0,0 +1,5 @@
+DROP TABLE If Exists public.proxy_events;
+
+ALTER TABLE public.proxies
+    ALTER COLUMN last_used_at TYPE text USING last_used_at::text;
+ALTER TABLE public.proxies RENAME COLUMN last_used_at TO lastused;
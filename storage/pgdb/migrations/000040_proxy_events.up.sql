@@ -0,0 +1,20 @@
+-- lastused held time.Time.String() output, e.g.
+-- "2022-05-01 12:34:56.789 -0500 CDT m=+1.2"; the part up to the offset is
+-- something Postgres can read.
+ALTER TABLE public.proxies RENAME COLUMN lastused TO last_used_at;
+ALTER TABLE public.proxies
+    ALTER COLUMN last_used_at TYPE timestamp with time zone
+    USING substring(last_used_at from '^\S+ \S+ [+-]\d{4}')::timestamp with time zone;
+
+CREATE TABLE public.proxy_events (
+    id bigserial PRIMARY KEY,
+    occurred_at timestamp with time zone DEFAULT now() NOT NULL,
+    proxy text NOT NULL,
+    outcome text NOT NULL,
+    status integer,
+    latency_ms integer,
+    url text
+);
+
+CREATE INDEX proxy_events_proxy_occurred_at_index ON public.proxy_events USING btree (proxy, occurred_at DESC);
+CREATE INDEX proxy_events_occurred_at_index ON public.proxy_events USING btree (occurred_at);
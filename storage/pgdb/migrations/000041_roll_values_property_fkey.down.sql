@@ -0,0 +1,5 @@
+ALTER TABLE ONLY public.roll_values
+    DROP CONSTRAINT IF EXISTS roll_values_property_id_fkey;
+
+ALTER TABLE ONLY public.roll_values
+    ADD CONSTRAINT roll_values_property_id_fkey FOREIGN KEY (property_id) REFERENCES public.roll_values(id) NOT VALID;
@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS proxies_pool_updated ON public.proxies;
+DROP TRIGGER IF EXISTS proxies_pool_changed ON public.proxies;
+
+CREATE TRIGGER proxies_pool_changed
+    AFTER INSERT OR DELETE OR UPDATE OF ip, scheme, username, password, is_bad, failures
+    ON public.proxies
+    FOR EACH STATEMENT
+    EXECUTE FUNCTION public.bump_proxy_pool_version();
@@ -0,0 +1,23 @@
+-- Health checks write failures back on every passing check, which bumped the
+-- version, and so reloaded every scraper's pool, each round. Updates now only
+-- count when a column the pool is built from actually changes value, which
+-- takes a row trigger, as a statement trigger cannot see the old and new rows.
+DROP TRIGGER IF EXISTS proxies_pool_changed ON public.proxies;
+
+CREATE TRIGGER proxies_pool_changed
+    AFTER INSERT OR DELETE
+    ON public.proxies
+    FOR EACH STATEMENT
+    EXECUTE FUNCTION public.bump_proxy_pool_version();
+
+CREATE TRIGGER proxies_pool_updated
+    AFTER UPDATE OF ip, scheme, username, password, is_bad, failures
+    ON public.proxies
+    FOR EACH ROW
+    WHEN (OLD.ip IS DISTINCT FROM NEW.ip
+        OR OLD.scheme IS DISTINCT FROM NEW.scheme
+        OR OLD.username IS DISTINCT FROM NEW.username
+        OR OLD.password IS DISTINCT FROM NEW.password
+        OR OLD.is_bad IS DISTINCT FROM NEW.is_bad
+        OR OLD.failures IS DISTINCT FROM NEW.failures)
+    EXECUTE FUNCTION public.bump_proxy_pool_version();
@@ -0,0 +1,2 @@
+-- The backfilled years cannot be told apart from ones written since, so they
+-- are left in place.
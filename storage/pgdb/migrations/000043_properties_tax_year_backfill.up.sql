@@ -0,0 +1,9 @@
+-- Rows written before properties carried their tax year were default-year
+-- fetches, so the latest roll value year is the year they show.
+UPDATE public.properties p
+SET tax_year = rv.year
+FROM (SELECT property_id, max(year) AS year
+      FROM public.roll_values
+      GROUP BY property_id) rv
+WHERE rv.property_id = p.id
+  AND p.tax_year IS NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE public.dead_letters
+    DROP COLUMN IF EXISTS priority;
@@ -0,0 +1,2 @@
+ALTER TABLE public.dead_letters
+    ADD COLUMN priority integer DEFAULT 0 NOT NULL;
@@ -4,8 +4,28 @@ package pgdb
 
 import (
 	"database/sql"
+	"encoding/json"
+	"time"
 )
 
+type DeadLetter struct {
+	ID            int32
+	Url           string
+	PropertyID    sql.NullInt32
+	TaxYear       sql.NullInt32
+	Attempts      int32
+	Status        sql.NullInt32
+	Headers       json.RawMessage
+	Body          []byte
+	BodyTruncated bool
+	Proxy         string
+	UserAgent     string
+	LastError     string
+	ErrorChain    json.RawMessage
+	FailedAt      time.Time
+	Priority      int32
+}
+
 type Improvement struct {
 	ID          int32
 	Name        sql.NullString
@@ -14,6 +34,7 @@ type Improvement struct {
 	LivingArea  sql.NullFloat64
 	Value       sql.NullFloat64
 	PropertyID  sql.NullInt32
+	TaxYear     sql.NullInt32
 }
 
 type ImprovementDetail struct {
@@ -38,6 +59,7 @@ type Jurisdiction struct {
 	PropertyID     sql.NullInt32
 	UpdatedAt      sql.NullTime
 	CreatedAt      sql.NullTime
+	TaxYear        sql.NullInt32
 }
 
 type Land struct {
@@ -51,6 +73,7 @@ type Land struct {
 	EffDepth    sql.NullFloat64
 	MarketValue sql.NullInt32
 	PropertyID  sql.NullInt32
+	TaxYear     sql.NullInt32
 }
 
 type LandAndImproveValue struct {
@@ -78,7 +101,11 @@ type Owner struct {
 }
 
 type PendingUrl struct {
-	Url string
+	Url       string
+	CreatedAt time.Time
+	Priority  int32
+	SortKey   float64
+	ClaimedAt sql.NullTime
 }
 
 type Property struct {
@@ -102,13 +129,65 @@ type Property struct {
 	State               sql.NullString
 	CreatedAt           sql.NullTime
 	UpdatedAt           sql.NullTime
+	LastFetchedAt       sql.NullTime
+	SourceUpdatedAt     sql.NullTime
+	TaxYear             sql.NullInt32
+}
+
+type PropertySnapshot struct {
+	ID          int32
+	PropertyID  int32
+	TaxYear     int32
+	ContentHash string
+	Record      json.RawMessage
+	ValidFrom   time.Time
+	ValidTo     sql.NullTime
+}
+
+type PropertyTaxYear struct {
+	PropertyID          int32
+	TaxYear             int32
+	Zoning              sql.NullString
+	LegalDescription    sql.NullString
+	Exemptions          sql.NullString
+	OwnershipPercentage sql.NullString
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
 }
 
 type Proxy struct {
-	Ip       string
-	Lastused sql.NullString
-	Uses     sql.NullInt32
-	IsBad    sql.NullInt32
+	Ip              string
+	LastUsedAt      sql.NullTime
+	Uses            sql.NullInt32
+	IsBad           sql.NullInt32
+	Failures        int32
+	CooldownUntil   sql.NullTime
+	LastCheckedAt   sql.NullTime
+	LatencyMs       sql.NullInt32
+	LastError       sql.NullString
+	Scheme          string
+	Username        sql.NullString
+	Password        sql.NullString
+	Successes       float64
+	Blocks          float64
+	Timeouts        float64
+	LatenciesMs     []int32
+	MedianLatencyMs sql.NullInt32
+}
+
+type ProxyEvent struct {
+	ID         int64
+	OccurredAt time.Time
+	Proxy      string
+	Outcome    string
+	Status     sql.NullInt32
+	LatencyMs  sql.NullInt32
+	Url        sql.NullString
+}
+
+type ProxyPoolVersion struct {
+	ID      bool
+	Version int64
 }
 
 type RollValue struct {
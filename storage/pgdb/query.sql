@@ -19,8 +19,91 @@ LIMIT $1;
 -- name: RemovePendingURL :exec
 Delete from pending_urls where url = $1;
 
+-- name: ClaimPendingURLsRandom :many
+update pending_urls set claimed_at = now()
+where url in (select p.url from pending_urls p
+              where p.claimed_at is null or p.claimed_at < $1
+              order by p.sort_key
+              limit $2
+              for update skip locked)
+returning url;
+
+-- name: ClaimPendingURLsOldest :many
+update pending_urls set claimed_at = now()
+where url in (select p.url from pending_urls p
+              where p.claimed_at is null or p.claimed_at < $1
+              order by p.created_at
+              limit $2
+              for update skip locked)
+returning url;
+
+-- name: ClaimPendingURLsPriority :many
+update pending_urls set claimed_at = now()
+where url in (select p.url from pending_urls p
+              where p.claimed_at is null or p.claimed_at < $1
+              order by p.priority desc, p.created_at
+              limit $2
+              for update skip locked)
+returning url;
+
+-- name: EnqueuePendingURL :exec
+insert into pending_urls(url, priority) values ($1, $2)
+on conflict (url) do nothing;
+
+-- name: ReleasePendingURL :exec
+update pending_urls set claimed_at = null where url = $1;
+
 -- name: GetRemainingURLCount :one
 Select count(url) from pending_urls;
+
+-- name: UpsertDeadLetter :exec
+insert into dead_letters(url, property_id, tax_year, attempts, status, headers, body, body_truncated,
+                         proxy, user_agent, last_error, error_chain, priority)
+values($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,
+       coalesce((select priority from pending_urls where url = $1), 0))
+on conflict (url) do update
+    set property_id    = excluded.property_id,
+        tax_year       = excluded.tax_year,
+        attempts       = dead_letters.attempts + excluded.attempts,
+        status         = excluded.status,
+        headers        = excluded.headers,
+        body           = excluded.body,
+        body_truncated = excluded.body_truncated,
+        proxy          = excluded.proxy,
+        user_agent     = excluded.user_agent,
+        last_error     = excluded.last_error,
+        error_chain    = excluded.error_chain,
+        priority       = excluded.priority,
+        failed_at      = now();
+
+-- name: ListDeadLetters :many
+select id, url, attempts, status, proxy, last_error, failed_at from dead_letters
+where last_error ilike $1
+order by failed_at desc
+limit $2;
+
+-- name: GetDeadLetter :one
+select * from dead_letters
+where id = $1;
+
+-- name: RequeueDeadLetter :execrows
+with moved as (delete from dead_letters where id = $1 returning url, priority)
+insert into pending_urls(url, priority) select url, priority from moved
+on conflict (url) do nothing;
+
+-- name: RequeueDeadLetters :execrows
+with moved as (delete from dead_letters where last_error ilike $1 returning url, priority)
+insert into pending_urls(url, priority) select url, priority from moved
+on conflict (url) do nothing;
+
+-- name: DiscardDeadLetter :execrows
+delete from dead_letters
+where id = $1;
+
+-- name: DiscardDeadLetters :execrows
+delete from dead_letters
+where last_error ilike $1;
+
 -- name: GetImprovementDetail :one
 SELECT * FROM improvement_detail
 WHERE id = $1 LIMIT 1;
@@ -37,18 +120,91 @@ WHERE property_id = $1;
 SELECT * FROM jurisdictions
 WHERE property_id = $1;
 
--- name: GetValidProxy :one
-select ip, lastused, uses
+-- name: ListSelectableProxies :many
+select ip, last_used_at, uses, scheme, username, password, successes, blocks, timeouts, latencies_ms, median_latency_ms
 from proxies
+where is_bad = 0 and failures = 0;
+
+-- name: GetProxyPoolVersion :one
+select version from proxy_pool_version;
+
+-- name: SaveProxyStats :exec
+update proxies
+set uses              = $2,
+    last_used_at      = coalesce($3, last_used_at),
+    successes         = $4,
+    blocks            = $5,
+    timeouts          = $6,
+    latencies_ms      = $7,
+    median_latency_ms = $8
+where ip = $1;
+
+-- name: InsertProxyEvents :exec
+insert into proxy_events (occurred_at, proxy, outcome, status, latency_ms, url)
+select e.occurred_at, e.proxy, e.outcome, nullif(e.status, 0), nullif(e.latency_ms, 0), nullif(e.url, '')
+from unnest(sqlc.arg(occurred_at)::timestamptz[], sqlc.arg(proxy)::text[], sqlc.arg(outcome)::text[],
+            sqlc.arg(status)::int[], sqlc.arg(latency_ms)::int[], sqlc.arg(url)::text[])
+     as e(occurred_at, proxy, outcome, status, latency_ms, url);
+
+-- name: ListProxyEvents :many
+select * from proxy_events
+where proxy = $1
+order by occurred_at desc
+limit $2;
+
+-- name: SummarizeProxyEvents :many
+select proxy,
+       count(*) filter (where outcome = 'success')::int                                                  as successes,
+       count(*) filter (where outcome = 'blocked')::int                                                  as blocks,
+       count(*) filter (where outcome = 'timeout')::int                                                  as timeouts,
+       count(*) filter (where outcome = 'neutral')::int                                                  as neutral,
+       count(*) filter (where outcome = 'check_failed')::int                                             as failed_checks,
+       coalesce(percentile_disc(0.5) within group (order by latency_ms) filter (where outcome = 'success'), 0)::int  as median_latency_ms,
+       coalesce(percentile_disc(0.95) within group (order by latency_ms) filter (where outcome = 'success'), 0)::int as p95_latency_ms,
+       max(occurred_at)::timestamptz                                                                     as last_event_at
+from proxy_events
+where occurred_at >= $1
+group by proxy
+order by proxy;
+
+-- name: PruneProxyEvents :execrows
+delete from proxy_events where occurred_at < $1;
+
+-- name: CoolDownProxy :exec
+update proxies
+set failures        = failures + 1,
+    cooldown_until  = now() + make_interval(secs => least(sqlc.arg(base_seconds)::float8 * power(2, failures), sqlc.arg(max_seconds)::float8)),
+    last_checked_at = case when sqlc.arg(checked)::boolean then now() else last_checked_at end,
+    last_error      = sqlc.arg(last_error)
+where ip = sqlc.arg(ip);
+
+-- name: ReenableProxy :exec
+update proxies
+set failures        = 0,
+    cooldown_until  = null,
+    last_checked_at = now(),
+    latency_ms      = $2,
+    last_error      = null
+where ip = $1;
+
+-- name: InsertProxy :execrows
+insert into proxies(ip, scheme, username, password, uses, is_bad)
+values($1,$2,$3,$4,0,0)
+on conflict (ip) do nothing;
+
+-- name: ListAllProxies :many
+select * from proxies
+order by ip;
+
+-- name: ListProxiesToCheck :many
+select ip, scheme, username, password from proxies
 where is_bad = 0
-order by lastused asc, uses asc
-limit 1;
-
--- name: UpdateProxyLastUsedTime :exec
-update proxies set lastused = $1, uses = $2 where ip = $3;
+  and ((failures = 0 and (last_checked_at is null or last_checked_at < $1))
+    or (failures > 0 and cooldown_until <= now()))
+order by last_checked_at nulls first;
 
 -- name: InsertLand :exec
-insert into land(number, land_type, description, acres, square_feet, eff_front, eff_depth, market_value, property_id) values($1,$2,$3,$4,$5,$6,$7,$8,$9);
+insert into land(number, land_type, description, acres, square_feet, eff_front, eff_depth, market_value, property_id, tax_year) values($1,$2,$3,$4,$5,$6,$7,$8,$9,$10);
 
 -- name: InsertPropertyRecord :exec
 insert into properties(id,
@@ -63,14 +219,124 @@ values($1,$2,$3,$4,$5,$6,$7,$8,$9,$10);
 insert into roll_values( year, improvements, land_market, ag_valuation, appraised, homestead_cap, assessed, property_id) values($1,$2,$3,$4,$5,$6,$7,$8);
 
 -- name: InsertJurisdiction :exec
-insert into jurisdictions( entity, description, tax_rate, appraised_value, taxable_value, estimated_tax, property_id) values($1,$2,$3,$4,$5,$6,$7);
+insert into jurisdictions( entity, description, tax_rate, appraised_value, taxable_value, estimated_tax, property_id, tax_year) values($1,$2,$3,$4,$5,$6,$7,$8);
 
 -- name: InsertImprovement :one
-insert into improvements (name, description, state_code, living_area, value, property_id) values($1,$2,$3,$4,$5,$6) RETURNING id;;
+insert into improvements (name, description, state_code, living_area, value, property_id, tax_year) values($1,$2,$3,$4,$5,$6,$7) RETURNING id;;
 
 -- name: InsertImprovementDetail :exec
 insert into improvement_detail(improvement_id, improvement_type, description, class, exterior_wall, year_built, square_feet) values ($1,$2,$3,$4,$5,$6,$7) ;
 
+-- name: UpsertPropertyRecord :exec
+insert into properties(id,
+                       zoning,neighborhood_cd,neighborhood,
+                       address, legal_description, geographic_id, exemptions,
+                       ownership_percentage, mapsco_map_id, tax_year, created_at, updated_at)
+values($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11, now(), now())
+on conflict (id) do update
+    set zoning               = excluded.zoning,
+        neighborhood_cd      = excluded.neighborhood_cd,
+        neighborhood         = excluded.neighborhood,
+        address              = excluded.address,
+        legal_description    = excluded.legal_description,
+        geographic_id        = excluded.geographic_id,
+        exemptions           = excluded.exemptions,
+        ownership_percentage = excluded.ownership_percentage,
+        mapsco_map_id        = excluded.mapsco_map_id,
+        tax_year             = excluded.tax_year,
+        updated_at           = now()
+where properties.tax_year <= excluded.tax_year
+   or (properties.tax_year is null and sqlc.arg(default_year)::boolean);
+
+-- name: UpsertPropertyTaxYear :exec
+insert into property_tax_years(property_id, tax_year, zoning, legal_description, exemptions, ownership_percentage)
+values($1,$2,$3,$4,$5,$6)
+on conflict (property_id, tax_year) do update
+    set zoning               = excluded.zoning,
+        legal_description    = excluded.legal_description,
+        exemptions           = excluded.exemptions,
+        ownership_percentage = excluded.ownership_percentage,
+        updated_at           = now();
+
+-- name: ListPropertyIDsAfter :many
+select id from properties
+where id > $1
+order by id
+limit $2;
+
+-- name: ListPropertySnapshotYears :many
+select distinct tax_year from property_snapshots
+where property_id = $1;
+
+-- name: UpsertRollValue :exec
+insert into roll_values( year, improvements, land_market, ag_valuation, appraised, homestead_cap, assessed, property_id) values($1,$2,$3,$4,$5,$6,$7,$8)
+on conflict (property_id, year) do update
+    set improvements  = excluded.improvements,
+        land_market   = excluded.land_market,
+        ag_valuation  = excluded.ag_valuation,
+        appraised     = excluded.appraised,
+        homestead_cap = excluded.homestead_cap,
+        assessed      = excluded.assessed;
+
+-- Rows written before child rows were tagged with a tax year have a null
+-- tax_year; untagged says they are replaced along with the year's own.
+
+-- name: DeleteImprovementDetailsByPropertyYear :exec
+delete from improvement_detail
+where improvement_id in (select id from improvements where property_id = $1 and (tax_year = $2 or (sqlc.arg(untagged)::boolean and tax_year is null)));
+
+-- name: DeleteImprovementsByPropertyYear :exec
+delete from improvements where property_id = $1 and (tax_year = $2 or (sqlc.arg(untagged)::boolean and tax_year is null));
+
+-- name: DeleteJurisdictionsByPropertyYear :exec
+delete from jurisdictions where property_id = $1 and (tax_year = $2 or (sqlc.arg(untagged)::boolean and tax_year is null));
+
+-- name: DeleteLandByPropertyYear :exec
+delete from land where property_id = $1 and (tax_year = $2 or (sqlc.arg(untagged)::boolean and tax_year is null));
+
+
+-- name: MarkPropertyFetched :exec
+update properties
+set last_fetched_at   = now(),
+    source_updated_at = coalesce($2, source_updated_at)
+where id = $1;
+
+-- name: CountProperties :one
+select count(*) from properties;
+
+-- The county's last update is read off the live site when it can be, and
+-- otherwise taken as the latest one any stored property has seen.
+-- name: ListPropertiesDueForRefresh :many
+select id from properties
+where last_fetched_at is null
+   or last_fetched_at < $1
+   or source_updated_at < coalesce(sqlc.narg(source_updated_at)::timestamptz, (select max(p.source_updated_at) from properties p))
+order by last_fetched_at nulls first
+limit $3;
+
+-- name: GetCurrentPropertySnapshot :one
+select * from property_snapshots
+where property_id = $1 and tax_year = $2 and valid_to is null;
+
+-- name: ClosePropertySnapshot :exec
+update property_snapshots set valid_to = now() where id = $1;
+
+-- name: InsertPropertySnapshot :one
+insert into property_snapshots(property_id, tax_year, content_hash, record, valid_from)
+values ($1, $2, $3, $4, now())
+returning id;
+
+-- name: GetPropertySnapshotAsOf :one
+select * from property_snapshots
+where property_id = $1 and tax_year = $2
+  and valid_from <= $3 and (valid_to is null or valid_to > $3)
+order by valid_from desc
+limit 1;
+
+-- name: ListPropertySnapshots :many
+select * from property_snapshots
+where property_id = $1 and tax_year = $2
+order by valid_from;
 
 -- name: GetLandByPropertyID :many
 SELECT * FROM land
@@ -6,8 +6,329 @@ package pgdb
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
 )
 
+const claimPendingURLsOldest = `-- name: ClaimPendingURLsOldest :many
+update pending_urls set claimed_at = now()
+where url in (select p.url from pending_urls p
+              where p.claimed_at is null or p.claimed_at < $1
+              order by p.created_at
+              limit $2
+              for update skip locked)
+returning url
+`
+
+type ClaimPendingURLsOldestParams struct {
+	ClaimedAt sql.NullTime
+	Limit     int32
+}
+
+func (q *Queries) ClaimPendingURLsOldest(ctx context.Context, arg ClaimPendingURLsOldestParams) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, claimPendingURLsOldest, arg.ClaimedAt, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		items = append(items, url)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const claimPendingURLsPriority = `-- name: ClaimPendingURLsPriority :many
+update pending_urls set claimed_at = now()
+where url in (select p.url from pending_urls p
+              where p.claimed_at is null or p.claimed_at < $1
+              order by p.priority desc, p.created_at
+              limit $2
+              for update skip locked)
+returning url
+`
+
+type ClaimPendingURLsPriorityParams struct {
+	ClaimedAt sql.NullTime
+	Limit     int32
+}
+
+func (q *Queries) ClaimPendingURLsPriority(ctx context.Context, arg ClaimPendingURLsPriorityParams) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, claimPendingURLsPriority, arg.ClaimedAt, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		items = append(items, url)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const claimPendingURLsRandom = `-- name: ClaimPendingURLsRandom :many
+update pending_urls set claimed_at = now()
+where url in (select p.url from pending_urls p
+              where p.claimed_at is null or p.claimed_at < $1
+              order by p.sort_key
+              limit $2
+              for update skip locked)
+returning url
+`
+
+type ClaimPendingURLsRandomParams struct {
+	ClaimedAt sql.NullTime
+	Limit     int32
+}
+
+func (q *Queries) ClaimPendingURLsRandom(ctx context.Context, arg ClaimPendingURLsRandomParams) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, claimPendingURLsRandom, arg.ClaimedAt, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		items = append(items, url)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const closePropertySnapshot = `-- name: ClosePropertySnapshot :exec
+update property_snapshots set valid_to = now() where id = $1
+`
+
+func (q *Queries) ClosePropertySnapshot(ctx context.Context, id int32) error {
+	_, err := q.db.ExecContext(ctx, closePropertySnapshot, id)
+	return err
+}
+
+const coolDownProxy = `-- name: CoolDownProxy :exec
+update proxies
+set failures        = failures + 1,
+    cooldown_until  = now() + make_interval(secs => least($1::float8 * power(2, failures), $2::float8)),
+    last_checked_at = case when $3::boolean then now() else last_checked_at end,
+    last_error      = $4
+where ip = $5
+`
+
+type CoolDownProxyParams struct {
+	BaseSeconds float64
+	MaxSeconds  float64
+	Checked     bool
+	LastError   sql.NullString
+	Ip          string
+}
+
+func (q *Queries) CoolDownProxy(ctx context.Context, arg CoolDownProxyParams) error {
+	_, err := q.db.ExecContext(ctx, coolDownProxy,
+		arg.BaseSeconds,
+		arg.MaxSeconds,
+		arg.Checked,
+		arg.LastError,
+		arg.Ip,
+	)
+	return err
+}
+
+const countProperties = `-- name: CountProperties :one
+select count(*) from properties
+`
+
+func (q *Queries) CountProperties(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countProperties)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const deleteImprovementDetailsByPropertyYear = `-- name: DeleteImprovementDetailsByPropertyYear :exec
+delete from improvement_detail
+where improvement_id in (select id from improvements where property_id = $1 and (tax_year = $2 or ($3::boolean and tax_year is null)))
+`
+
+type DeleteImprovementDetailsByPropertyYearParams struct {
+	PropertyID sql.NullInt32
+	TaxYear    sql.NullInt32
+	Untagged   bool
+}
+
+func (q *Queries) DeleteImprovementDetailsByPropertyYear(ctx context.Context, arg DeleteImprovementDetailsByPropertyYearParams) error {
+	_, err := q.db.ExecContext(ctx, deleteImprovementDetailsByPropertyYear, arg.PropertyID, arg.TaxYear, arg.Untagged)
+	return err
+}
+
+const deleteImprovementsByPropertyYear = `-- name: DeleteImprovementsByPropertyYear :exec
+delete from improvements where property_id = $1 and (tax_year = $2 or ($3::boolean and tax_year is null))
+`
+
+type DeleteImprovementsByPropertyYearParams struct {
+	PropertyID sql.NullInt32
+	TaxYear    sql.NullInt32
+	Untagged   bool
+}
+
+func (q *Queries) DeleteImprovementsByPropertyYear(ctx context.Context, arg DeleteImprovementsByPropertyYearParams) error {
+	_, err := q.db.ExecContext(ctx, deleteImprovementsByPropertyYear, arg.PropertyID, arg.TaxYear, arg.Untagged)
+	return err
+}
+
+const deleteJurisdictionsByPropertyYear = `-- name: DeleteJurisdictionsByPropertyYear :exec
+delete from jurisdictions where property_id = $1 and (tax_year = $2 or ($3::boolean and tax_year is null))
+`
+
+type DeleteJurisdictionsByPropertyYearParams struct {
+	PropertyID sql.NullInt32
+	TaxYear    sql.NullInt32
+	Untagged   bool
+}
+
+func (q *Queries) DeleteJurisdictionsByPropertyYear(ctx context.Context, arg DeleteJurisdictionsByPropertyYearParams) error {
+	_, err := q.db.ExecContext(ctx, deleteJurisdictionsByPropertyYear, arg.PropertyID, arg.TaxYear, arg.Untagged)
+	return err
+}
+
+const deleteLandByPropertyYear = `-- name: DeleteLandByPropertyYear :exec
+delete from land where property_id = $1 and (tax_year = $2 or ($3::boolean and tax_year is null))
+`
+
+type DeleteLandByPropertyYearParams struct {
+	PropertyID sql.NullInt32
+	TaxYear    sql.NullInt32
+	Untagged   bool
+}
+
+func (q *Queries) DeleteLandByPropertyYear(ctx context.Context, arg DeleteLandByPropertyYearParams) error {
+	_, err := q.db.ExecContext(ctx, deleteLandByPropertyYear, arg.PropertyID, arg.TaxYear, arg.Untagged)
+	return err
+}
+
+const discardDeadLetter = `-- name: DiscardDeadLetter :execrows
+delete from dead_letters
+where id = $1
+`
+
+func (q *Queries) DiscardDeadLetter(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, discardDeadLetter, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const discardDeadLetters = `-- name: DiscardDeadLetters :execrows
+delete from dead_letters
+where last_error ilike $1
+`
+
+func (q *Queries) DiscardDeadLetters(ctx context.Context, lastError string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, discardDeadLetters, lastError)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const enqueuePendingURL = `-- name: EnqueuePendingURL :exec
+insert into pending_urls(url, priority) values ($1, $2)
+on conflict (url) do nothing
+`
+
+type EnqueuePendingURLParams struct {
+	Url      string
+	Priority int32
+}
+
+func (q *Queries) EnqueuePendingURL(ctx context.Context, arg EnqueuePendingURLParams) error {
+	_, err := q.db.ExecContext(ctx, enqueuePendingURL, arg.Url, arg.Priority)
+	return err
+}
+
+const getCurrentPropertySnapshot = `-- name: GetCurrentPropertySnapshot :one
+select id, property_id, tax_year, content_hash, record, valid_from, valid_to from property_snapshots
+where property_id = $1 and tax_year = $2 and valid_to is null
+`
+
+type GetCurrentPropertySnapshotParams struct {
+	PropertyID int32
+	TaxYear    int32
+}
+
+func (q *Queries) GetCurrentPropertySnapshot(ctx context.Context, arg GetCurrentPropertySnapshotParams) (PropertySnapshot, error) {
+	row := q.db.QueryRowContext(ctx, getCurrentPropertySnapshot, arg.PropertyID, arg.TaxYear)
+	var i PropertySnapshot
+	err := row.Scan(
+		&i.ID,
+		&i.PropertyID,
+		&i.TaxYear,
+		&i.ContentHash,
+		&i.Record,
+		&i.ValidFrom,
+		&i.ValidTo,
+	)
+	return i, err
+}
+
+const getDeadLetter = `-- name: GetDeadLetter :one
+select id, url, property_id, tax_year, attempts, status, headers, body, body_truncated, proxy, user_agent, last_error, error_chain, failed_at, priority from dead_letters
+where id = $1
+`
+
+func (q *Queries) GetDeadLetter(ctx context.Context, id int32) (DeadLetter, error) {
+	row := q.db.QueryRowContext(ctx, getDeadLetter, id)
+	var i DeadLetter
+	err := row.Scan(
+		&i.ID,
+		&i.Url,
+		&i.PropertyID,
+		&i.TaxYear,
+		&i.Attempts,
+		&i.Status,
+		&i.Headers,
+		&i.Body,
+		&i.BodyTruncated,
+		&i.Proxy,
+		&i.UserAgent,
+		&i.LastError,
+		&i.ErrorChain,
+		&i.FailedAt,
+		&i.Priority,
+	)
+	return i, err
+}
+
 const getDistinctNeighborhoods = `-- name: GetDistinctNeighborhoods :many
 Select Distinct neighborhood from properties order by neighborhood asc
 `
@@ -63,7 +384,7 @@ func (q *Queries) GetDistinctStreets(ctx context.Context) ([]sql.NullString, err
 }
 
 const getImprovementByID = `-- name: GetImprovementByID :one
-SELECT id, name, description, state_code, living_area, value, property_id FROM improvements
+SELECT id, name, description, state_code, living_area, value, property_id, tax_year FROM improvements
 WHERE id = $1 limit 1
 `
 
@@ -78,6 +399,7 @@ func (q *Queries) GetImprovementByID(ctx context.Context, id int32) (Improvement
 		&i.LivingArea,
 		&i.Value,
 		&i.PropertyID,
+		&i.TaxYear,
 	)
 	return i, err
 }
@@ -143,7 +465,7 @@ func (q *Queries) GetImprovementDetails(ctx context.Context, improvementID sql.N
 }
 
 const getImprovementsByPropertyID = `-- name: GetImprovementsByPropertyID :many
-SELECT id, name, description, state_code, living_area, value, property_id FROM improvements
+SELECT id, name, description, state_code, living_area, value, property_id, tax_year FROM improvements
 WHERE property_id = $1
 `
 
@@ -164,6 +486,7 @@ func (q *Queries) GetImprovementsByPropertyID(ctx context.Context, propertyID sq
 			&i.LivingArea,
 			&i.Value,
 			&i.PropertyID,
+			&i.TaxYear,
 		); err != nil {
 			return nil, err
 		}
@@ -179,7 +502,7 @@ func (q *Queries) GetImprovementsByPropertyID(ctx context.Context, propertyID sq
 }
 
 const getJurisdictionsByPropertyID = `-- name: GetJurisdictionsByPropertyID :many
-SELECT id, entity, description, tax_rate, appraised_value, taxable_value, estimated_tax, property_id, updated_at, created_at FROM jurisdictions
+SELECT id, entity, description, tax_rate, appraised_value, taxable_value, estimated_tax, property_id, updated_at, created_at, tax_year FROM jurisdictions
 WHERE property_id = $1
 `
 
@@ -203,6 +526,7 @@ func (q *Queries) GetJurisdictionsByPropertyID(ctx context.Context, propertyID s
 			&i.PropertyID,
 			&i.UpdatedAt,
 			&i.CreatedAt,
+			&i.TaxYear,
 		); err != nil {
 			return nil, err
 		}
@@ -218,7 +542,7 @@ func (q *Queries) GetJurisdictionsByPropertyID(ctx context.Context, propertyID s
 }
 
 const getLandByPropertyID = `-- name: GetLandByPropertyID :many
-SELECT id, number, land_type, description, acres, square_feet, eff_front, eff_depth, market_value, property_id FROM land
+SELECT id, number, land_type, description, acres, square_feet, eff_front, eff_depth, market_value, property_id, tax_year FROM land
 WHERE property_id = $1
 `
 
@@ -242,6 +566,7 @@ func (q *Queries) GetLandByPropertyID(ctx context.Context, propertyID sql.NullIn
 			&i.EffDepth,
 			&i.MarketValue,
 			&i.PropertyID,
+			&i.TaxYear,
 		); err != nil {
 			return nil, err
 		}
@@ -257,7 +582,7 @@ func (q *Queries) GetLandByPropertyID(ctx context.Context, propertyID sql.NullIn
 }
 
 const getLandBySize = `-- name: GetLandBySize :many
-SELECT id, number, land_type, description, acres, square_feet, eff_front, eff_depth, market_value, property_id FROM land
+SELECT id, number, land_type, description, acres, square_feet, eff_front, eff_depth, market_value, property_id, tax_year FROM land
 WHERE acres >= $1
  and acres <= $2
 `
@@ -287,6 +612,7 @@ func (q *Queries) GetLandBySize(ctx context.Context, arg GetLandBySizeParams) ([
 			&i.EffDepth,
 			&i.MarketValue,
 			&i.PropertyID,
+			&i.TaxYear,
 		); err != nil {
 			return nil, err
 		}
@@ -302,7 +628,7 @@ func (q *Queries) GetLandBySize(ctx context.Context, arg GetLandBySizeParams) ([
 }
 
 const getLandByType = `-- name: GetLandByType :many
-SELECT id, number, land_type, description, acres, square_feet, eff_front, eff_depth, market_value, property_id FROM land
+SELECT id, number, land_type, description, acres, square_feet, eff_front, eff_depth, market_value, property_id, tax_year FROM land
 WHERE land_type = $1
 `
 
@@ -326,6 +652,7 @@ func (q *Queries) GetLandByType(ctx context.Context, landType sql.NullString) ([
 			&i.EffDepth,
 			&i.MarketValue,
 			&i.PropertyID,
+			&i.TaxYear,
 		); err != nil {
 			return nil, err
 		}
@@ -368,7 +695,7 @@ func (q *Queries) GetNeighborhoodsLike(ctx context.Context, upper string) ([]sql
 }
 
 const getPropertyByID = `-- name: GetPropertyByID :one
-SELECT id, zoning, neighborhood_cd, neighborhood, address, legal_description, geographic_id, exemptions, ownership_percentage, mapsco_map_id, longitude, latitude, address_number, address_line_two, city, street, county, state, created_at, updated_at FROM properties
+SELECT id, zoning, neighborhood_cd, neighborhood, address, legal_description, geographic_id, exemptions, ownership_percentage, mapsco_map_id, longitude, latitude, address_number, address_line_two, city, street, county, state, created_at, updated_at, last_fetched_at, source_updated_at, tax_year FROM properties
 WHERE id = $1 limit 1
 `
 
@@ -396,12 +723,15 @@ func (q *Queries) GetPropertyByID(ctx context.Context, id int32) (Property, erro
 		&i.State,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.LastFetchedAt,
+		&i.SourceUpdatedAt,
+		&i.TaxYear,
 	)
 	return i, err
 }
 
 const getPropertyByNeighborhood = `-- name: GetPropertyByNeighborhood :many
-SELECT id, zoning, neighborhood_cd, neighborhood, address, legal_description, geographic_id, exemptions, ownership_percentage, mapsco_map_id, longitude, latitude, address_number, address_line_two, city, street, county, state, created_at, updated_at FROM properties
+SELECT id, zoning, neighborhood_cd, neighborhood, address, legal_description, geographic_id, exemptions, ownership_percentage, mapsco_map_id, longitude, latitude, address_number, address_line_two, city, street, county, state, created_at, updated_at, last_fetched_at, source_updated_at, tax_year FROM properties
 WHERE neighborhood = $1
 `
 
@@ -435,6 +765,9 @@ func (q *Queries) GetPropertyByNeighborhood(ctx context.Context, neighborhood sq
 			&i.State,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.LastFetchedAt,
+			&i.SourceUpdatedAt,
+			&i.TaxYear,
 		); err != nil {
 			return nil, err
 		}
@@ -450,7 +783,7 @@ func (q *Queries) GetPropertyByNeighborhood(ctx context.Context, neighborhood sq
 }
 
 const getPropertyByStreet = `-- name: GetPropertyByStreet :many
-Select id, zoning, neighborhood_cd, neighborhood, address, legal_description, geographic_id, exemptions, ownership_percentage, mapsco_map_id, longitude, latitude, address_number, address_line_two, city, street, county, state, created_at, updated_at from properties where UPPER(street) = UPPER($1) order by address_number,street,city asc
+Select id, zoning, neighborhood_cd, neighborhood, address, legal_description, geographic_id, exemptions, ownership_percentage, mapsco_map_id, longitude, latitude, address_number, address_line_two, city, street, county, state, created_at, updated_at, last_fetched_at, source_updated_at, tax_year from properties where UPPER(street) = UPPER($1) order by address_number,street,city asc
 `
 
 func (q *Queries) GetPropertyByStreet(ctx context.Context, upper string) ([]Property, error) {
@@ -483,6 +816,9 @@ func (q *Queries) GetPropertyByStreet(ctx context.Context, upper string) ([]Prop
 			&i.State,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.LastFetchedAt,
+			&i.SourceUpdatedAt,
+			&i.TaxYear,
 		); err != nil {
 			return nil, err
 		}
@@ -497,6 +833,46 @@ func (q *Queries) GetPropertyByStreet(ctx context.Context, upper string) ([]Prop
 	return items, nil
 }
 
+const getPropertySnapshotAsOf = `-- name: GetPropertySnapshotAsOf :one
+select id, property_id, tax_year, content_hash, record, valid_from, valid_to from property_snapshots
+where property_id = $1 and tax_year = $2
+  and valid_from <= $3 and (valid_to is null or valid_to > $3)
+order by valid_from desc
+limit 1
+`
+
+type GetPropertySnapshotAsOfParams struct {
+	PropertyID int32
+	TaxYear    int32
+	ValidFrom  time.Time
+}
+
+func (q *Queries) GetPropertySnapshotAsOf(ctx context.Context, arg GetPropertySnapshotAsOfParams) (PropertySnapshot, error) {
+	row := q.db.QueryRowContext(ctx, getPropertySnapshotAsOf, arg.PropertyID, arg.TaxYear, arg.ValidFrom)
+	var i PropertySnapshot
+	err := row.Scan(
+		&i.ID,
+		&i.PropertyID,
+		&i.TaxYear,
+		&i.ContentHash,
+		&i.Record,
+		&i.ValidFrom,
+		&i.ValidTo,
+	)
+	return i, err
+}
+
+const getProxyPoolVersion = `-- name: GetProxyPoolVersion :one
+select version from proxy_pool_version
+`
+
+func (q *Queries) GetProxyPoolVersion(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getProxyPoolVersion)
+	var version int64
+	err := row.Scan(&version)
+	return version, err
+}
+
 const getRandomURLs = `-- name: GetRandomURLs :many
 SELECT url  FROM pending_urls
 ORDER BY RANDOM()
@@ -602,29 +978,8 @@ func (q *Queries) GetStreetsLike(ctx context.Context, dollar_1 string) ([]sql.Nu
 	return items, nil
 }
 
-const getValidProxy = `-- name: GetValidProxy :one
-select ip, lastused, uses
-from proxies
-where is_bad = 0
-order by lastused asc, uses asc
-limit 1
-`
-
-type GetValidProxyRow struct {
-	Ip       string
-	Lastused sql.NullString
-	Uses     sql.NullInt32
-}
-
-func (q *Queries) GetValidProxy(ctx context.Context) (GetValidProxyRow, error) {
-	row := q.db.QueryRowContext(ctx, getValidProxy)
-	var i GetValidProxyRow
-	err := row.Scan(&i.Ip, &i.Lastused, &i.Uses)
-	return i, err
-}
-
 const insertImprovement = `-- name: InsertImprovement :one
-insert into improvements (name, description, state_code, living_area, value, property_id) values($1,$2,$3,$4,$5,$6) RETURNING id
+insert into improvements (name, description, state_code, living_area, value, property_id, tax_year) values($1,$2,$3,$4,$5,$6,$7) RETURNING id
 `
 
 type InsertImprovementParams struct {
@@ -634,6 +989,7 @@ type InsertImprovementParams struct {
 	LivingArea  sql.NullFloat64
 	Value       sql.NullFloat64
 	PropertyID  sql.NullInt32
+	TaxYear     sql.NullInt32
 }
 
 func (q *Queries) InsertImprovement(ctx context.Context, arg InsertImprovementParams) (int32, error) {
@@ -644,6 +1000,7 @@ func (q *Queries) InsertImprovement(ctx context.Context, arg InsertImprovementPa
 		arg.LivingArea,
 		arg.Value,
 		arg.PropertyID,
+		arg.TaxYear,
 	)
 	var id int32
 	err := row.Scan(&id)
@@ -678,7 +1035,7 @@ func (q *Queries) InsertImprovementDetail(ctx context.Context, arg InsertImprove
 }
 
 const insertJurisdiction = `-- name: InsertJurisdiction :exec
-insert into jurisdictions( entity, description, tax_rate, appraised_value, taxable_value, estimated_tax, property_id) values($1,$2,$3,$4,$5,$6,$7)
+insert into jurisdictions( entity, description, tax_rate, appraised_value, taxable_value, estimated_tax, property_id, tax_year) values($1,$2,$3,$4,$5,$6,$7,$8)
 `
 
 type InsertJurisdictionParams struct {
@@ -689,6 +1046,7 @@ type InsertJurisdictionParams struct {
 	TaxableValue   sql.NullInt32
 	EstimatedTax   sql.NullInt32
 	PropertyID     sql.NullInt32
+	TaxYear        sql.NullInt32
 }
 
 func (q *Queries) InsertJurisdiction(ctx context.Context, arg InsertJurisdictionParams) error {
@@ -700,12 +1058,13 @@ func (q *Queries) InsertJurisdiction(ctx context.Context, arg InsertJurisdiction
 		arg.TaxableValue,
 		arg.EstimatedTax,
 		arg.PropertyID,
+		arg.TaxYear,
 	)
 	return err
 }
 
 const insertLand = `-- name: InsertLand :exec
-insert into land(number, land_type, description, acres, square_feet, eff_front, eff_depth, market_value, property_id) values($1,$2,$3,$4,$5,$6,$7,$8,$9)
+insert into land(number, land_type, description, acres, square_feet, eff_front, eff_depth, market_value, property_id, tax_year) values($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
 `
 
 type InsertLandParams struct {
@@ -718,6 +1077,7 @@ type InsertLandParams struct {
 	EffDepth    sql.NullFloat64
 	MarketValue sql.NullInt32
 	PropertyID  sql.NullInt32
+	TaxYear     sql.NullInt32
 }
 
 func (q *Queries) InsertLand(ctx context.Context, arg InsertLandParams) error {
@@ -731,6 +1091,7 @@ func (q *Queries) InsertLand(ctx context.Context, arg InsertLandParams) error {
 		arg.EffDepth,
 		arg.MarketValue,
 		arg.PropertyID,
+		arg.TaxYear,
 	)
 	return err
 }
@@ -772,6 +1133,86 @@ func (q *Queries) InsertPropertyRecord(ctx context.Context, arg InsertPropertyRe
 	return err
 }
 
+const insertPropertySnapshot = `-- name: InsertPropertySnapshot :one
+insert into property_snapshots(property_id, tax_year, content_hash, record, valid_from)
+values ($1, $2, $3, $4, now())
+returning id
+`
+
+type InsertPropertySnapshotParams struct {
+	PropertyID  int32
+	TaxYear     int32
+	ContentHash string
+	Record      json.RawMessage
+}
+
+func (q *Queries) InsertPropertySnapshot(ctx context.Context, arg InsertPropertySnapshotParams) (int32, error) {
+	row := q.db.QueryRowContext(ctx, insertPropertySnapshot,
+		arg.PropertyID,
+		arg.TaxYear,
+		arg.ContentHash,
+		arg.Record,
+	)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const insertProxy = `-- name: InsertProxy :execrows
+insert into proxies(ip, scheme, username, password, uses, is_bad)
+values($1,$2,$3,$4,0,0)
+on conflict (ip) do nothing
+`
+
+type InsertProxyParams struct {
+	Ip       string
+	Scheme   string
+	Username sql.NullString
+	Password sql.NullString
+}
+
+func (q *Queries) InsertProxy(ctx context.Context, arg InsertProxyParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, insertProxy,
+		arg.Ip,
+		arg.Scheme,
+		arg.Username,
+		arg.Password,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const insertProxyEvents = `-- name: InsertProxyEvents :exec
+insert into proxy_events (occurred_at, proxy, outcome, status, latency_ms, url)
+select e.occurred_at, e.proxy, e.outcome, nullif(e.status, 0), nullif(e.latency_ms, 0), nullif(e.url, '')
+from unnest($1::timestamptz[], $2::text[], $3::text[],
+            $4::int[], $5::int[], $6::text[])
+     as e(occurred_at, proxy, outcome, status, latency_ms, url)
+`
+
+type InsertProxyEventsParams struct {
+	OccurredAt []time.Time
+	Proxy      []string
+	Outcome    []string
+	Status     []int32
+	LatencyMs  []int32
+	Url        []string
+}
+
+func (q *Queries) InsertProxyEvents(ctx context.Context, arg InsertProxyEventsParams) error {
+	_, err := q.db.ExecContext(ctx, insertProxyEvents,
+		pq.Array(arg.OccurredAt),
+		pq.Array(arg.Proxy),
+		pq.Array(arg.Outcome),
+		pq.Array(arg.Status),
+		pq.Array(arg.LatencyMs),
+		pq.Array(arg.Url),
+	)
+	return err
+}
+
 const insertRollValue = `-- name: InsertRollValue :exec
 
 insert into roll_values( year, improvements, land_market, ag_valuation, appraised, homestead_cap, assessed, property_id) values($1,$2,$3,$4,$5,$6,$7,$8)
@@ -814,45 +1255,38 @@ func (q *Queries) IsExistingProperty(ctx context.Context, id int32) (bool, error
 	return exists, err
 }
 
-const listProperties = `-- name: ListProperties :many
-Select id, zoning, neighborhood_cd, neighborhood, address, legal_description, geographic_id, exemptions, ownership_percentage, mapsco_map_id, longitude, latitude, address_number, address_line_two, city, street, county, state, created_at, updated_at from properties limit $1 offset $2
+const listAllProxies = `-- name: ListAllProxies :many
+select ip, last_used_at, uses, is_bad, failures, cooldown_until, last_checked_at, latency_ms, last_error, scheme, username, password, successes, blocks, timeouts, latencies_ms, median_latency_ms from proxies
+order by ip
 `
 
-type ListPropertiesParams struct {
-	Limit  int32
-	Offset int32
-}
-
-func (q *Queries) ListProperties(ctx context.Context, arg ListPropertiesParams) ([]Property, error) {
-	rows, err := q.db.QueryContext(ctx, listProperties, arg.Limit, arg.Offset)
+func (q *Queries) ListAllProxies(ctx context.Context) ([]Proxy, error) {
+	rows, err := q.db.QueryContext(ctx, listAllProxies)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Property
+	var items []Proxy
 	for rows.Next() {
-		var i Property
+		var i Proxy
 		if err := rows.Scan(
-			&i.ID,
-			&i.Zoning,
-			&i.NeighborhoodCd,
-			&i.Neighborhood,
-			&i.Address,
-			&i.LegalDescription,
-			&i.GeographicID,
-			&i.Exemptions,
-			&i.OwnershipPercentage,
-			&i.MapscoMapID,
-			&i.Longitude,
-			&i.Latitude,
-			&i.AddressNumber,
-			&i.AddressLineTwo,
-			&i.City,
-			&i.Street,
-			&i.County,
-			&i.State,
-			&i.CreatedAt,
-			&i.UpdatedAt,
+			&i.Ip,
+			&i.LastUsedAt,
+			&i.Uses,
+			&i.IsBad,
+			&i.Failures,
+			&i.CooldownUntil,
+			&i.LastCheckedAt,
+			&i.LatencyMs,
+			&i.LastError,
+			&i.Scheme,
+			&i.Username,
+			&i.Password,
+			&i.Successes,
+			&i.Blocks,
+			&i.Timeouts,
+			pq.Array(&i.LatenciesMs),
+			&i.MedianLatencyMs,
 		); err != nil {
 			return nil, err
 		}
@@ -867,17 +1301,594 @@ func (q *Queries) ListProperties(ctx context.Context, arg ListPropertiesParams)
 	return items, nil
 }
 
-const removePendingURL = `-- name: RemovePendingURL :exec
-Delete from pending_urls where url = $1
+const listDeadLetters = `-- name: ListDeadLetters :many
+select id, url, attempts, status, proxy, last_error, failed_at from dead_letters
+where last_error ilike $1
+order by failed_at desc
+limit $2
 `
 
-func (q *Queries) RemovePendingURL(ctx context.Context, url string) error {
-	_, err := q.db.ExecContext(ctx, removePendingURL, url)
-	return err
+type ListDeadLettersParams struct {
+	LastError string
+	Limit     int32
 }
 
-const updatePropertySetAddressParts = `-- name: UpdatePropertySetAddressParts :exec
-Update properties set address_number = $1, address_line_two = $2, street = $3, city = $4, county = $5, state = $6
+type ListDeadLettersRow struct {
+	ID        int32
+	Url       string
+	Attempts  int32
+	Status    sql.NullInt32
+	Proxy     string
+	LastError string
+	FailedAt  time.Time
+}
+
+func (q *Queries) ListDeadLetters(ctx context.Context, arg ListDeadLettersParams) ([]ListDeadLettersRow, error) {
+	rows, err := q.db.QueryContext(ctx, listDeadLetters, arg.LastError, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListDeadLettersRow
+	for rows.Next() {
+		var i ListDeadLettersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Url,
+			&i.Attempts,
+			&i.Status,
+			&i.Proxy,
+			&i.LastError,
+			&i.FailedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listProperties = `-- name: ListProperties :many
+Select id, zoning, neighborhood_cd, neighborhood, address, legal_description, geographic_id, exemptions, ownership_percentage, mapsco_map_id, longitude, latitude, address_number, address_line_two, city, street, county, state, created_at, updated_at, last_fetched_at, source_updated_at, tax_year from properties limit $1 offset $2
+`
+
+type ListPropertiesParams struct {
+	Limit  int32
+	Offset int32
+}
+
+func (q *Queries) ListProperties(ctx context.Context, arg ListPropertiesParams) ([]Property, error) {
+	rows, err := q.db.QueryContext(ctx, listProperties, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Property
+	for rows.Next() {
+		var i Property
+		if err := rows.Scan(
+			&i.ID,
+			&i.Zoning,
+			&i.NeighborhoodCd,
+			&i.Neighborhood,
+			&i.Address,
+			&i.LegalDescription,
+			&i.GeographicID,
+			&i.Exemptions,
+			&i.OwnershipPercentage,
+			&i.MapscoMapID,
+			&i.Longitude,
+			&i.Latitude,
+			&i.AddressNumber,
+			&i.AddressLineTwo,
+			&i.City,
+			&i.Street,
+			&i.County,
+			&i.State,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.LastFetchedAt,
+			&i.SourceUpdatedAt,
+			&i.TaxYear,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPropertiesDueForRefresh = `-- name: ListPropertiesDueForRefresh :many
+select id from properties
+where last_fetched_at is null
+   or last_fetched_at < $1
+   or source_updated_at < coalesce($2::timestamptz, (select max(p.source_updated_at) from properties p))
+order by last_fetched_at nulls first
+limit $3
+`
+
+type ListPropertiesDueForRefreshParams struct {
+	LastFetchedAt   sql.NullTime
+	SourceUpdatedAt sql.NullTime
+	Limit           int32
+}
+
+func (q *Queries) ListPropertiesDueForRefresh(ctx context.Context, arg ListPropertiesDueForRefreshParams) ([]int32, error) {
+	rows, err := q.db.QueryContext(ctx, listPropertiesDueForRefresh, arg.LastFetchedAt, arg.SourceUpdatedAt, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int32
+	for rows.Next() {
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPropertyIDsAfter = `-- name: ListPropertyIDsAfter :many
+select id from properties
+where id > $1
+order by id
+limit $2
+`
+
+type ListPropertyIDsAfterParams struct {
+	ID    int32
+	Limit int32
+}
+
+func (q *Queries) ListPropertyIDsAfter(ctx context.Context, arg ListPropertyIDsAfterParams) ([]int32, error) {
+	rows, err := q.db.QueryContext(ctx, listPropertyIDsAfter, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int32
+	for rows.Next() {
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPropertySnapshotYears = `-- name: ListPropertySnapshotYears :many
+select distinct tax_year from property_snapshots
+where property_id = $1
+`
+
+func (q *Queries) ListPropertySnapshotYears(ctx context.Context, propertyID int32) ([]int32, error) {
+	rows, err := q.db.QueryContext(ctx, listPropertySnapshotYears, propertyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int32
+	for rows.Next() {
+		var tax_year int32
+		if err := rows.Scan(&tax_year); err != nil {
+			return nil, err
+		}
+		items = append(items, tax_year)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPropertySnapshots = `-- name: ListPropertySnapshots :many
+select id, property_id, tax_year, content_hash, record, valid_from, valid_to from property_snapshots
+where property_id = $1 and tax_year = $2
+order by valid_from
+`
+
+type ListPropertySnapshotsParams struct {
+	PropertyID int32
+	TaxYear    int32
+}
+
+func (q *Queries) ListPropertySnapshots(ctx context.Context, arg ListPropertySnapshotsParams) ([]PropertySnapshot, error) {
+	rows, err := q.db.QueryContext(ctx, listPropertySnapshots, arg.PropertyID, arg.TaxYear)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PropertySnapshot
+	for rows.Next() {
+		var i PropertySnapshot
+		if err := rows.Scan(
+			&i.ID,
+			&i.PropertyID,
+			&i.TaxYear,
+			&i.ContentHash,
+			&i.Record,
+			&i.ValidFrom,
+			&i.ValidTo,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listProxiesToCheck = `-- name: ListProxiesToCheck :many
+select ip, scheme, username, password from proxies
+where is_bad = 0
+  and ((failures = 0 and (last_checked_at is null or last_checked_at < $1))
+    or (failures > 0 and cooldown_until <= now()))
+order by last_checked_at nulls first
+`
+
+type ListProxiesToCheckRow struct {
+	Ip       string
+	Scheme   string
+	Username sql.NullString
+	Password sql.NullString
+}
+
+func (q *Queries) ListProxiesToCheck(ctx context.Context, lastCheckedAt sql.NullTime) ([]ListProxiesToCheckRow, error) {
+	rows, err := q.db.QueryContext(ctx, listProxiesToCheck, lastCheckedAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListProxiesToCheckRow
+	for rows.Next() {
+		var i ListProxiesToCheckRow
+		if err := rows.Scan(
+			&i.Ip,
+			&i.Scheme,
+			&i.Username,
+			&i.Password,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listProxyEvents = `-- name: ListProxyEvents :many
+select id, occurred_at, proxy, outcome, status, latency_ms, url from proxy_events
+where proxy = $1
+order by occurred_at desc
+limit $2
+`
+
+type ListProxyEventsParams struct {
+	Proxy string
+	Limit int32
+}
+
+func (q *Queries) ListProxyEvents(ctx context.Context, arg ListProxyEventsParams) ([]ProxyEvent, error) {
+	rows, err := q.db.QueryContext(ctx, listProxyEvents, arg.Proxy, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ProxyEvent
+	for rows.Next() {
+		var i ProxyEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.OccurredAt,
+			&i.Proxy,
+			&i.Outcome,
+			&i.Status,
+			&i.LatencyMs,
+			&i.Url,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSelectableProxies = `-- name: ListSelectableProxies :many
+select ip, last_used_at, uses, scheme, username, password, successes, blocks, timeouts, latencies_ms, median_latency_ms
+from proxies
+where is_bad = 0 and failures = 0
+`
+
+type ListSelectableProxiesRow struct {
+	Ip              string
+	LastUsedAt      sql.NullTime
+	Uses            sql.NullInt32
+	Scheme          string
+	Username        sql.NullString
+	Password        sql.NullString
+	Successes       float64
+	Blocks          float64
+	Timeouts        float64
+	LatenciesMs     []int32
+	MedianLatencyMs sql.NullInt32
+}
+
+func (q *Queries) ListSelectableProxies(ctx context.Context) ([]ListSelectableProxiesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listSelectableProxies)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListSelectableProxiesRow
+	for rows.Next() {
+		var i ListSelectableProxiesRow
+		if err := rows.Scan(
+			&i.Ip,
+			&i.LastUsedAt,
+			&i.Uses,
+			&i.Scheme,
+			&i.Username,
+			&i.Password,
+			&i.Successes,
+			&i.Blocks,
+			&i.Timeouts,
+			pq.Array(&i.LatenciesMs),
+			&i.MedianLatencyMs,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markPropertyFetched = `-- name: MarkPropertyFetched :exec
+update properties
+set last_fetched_at   = now(),
+    source_updated_at = coalesce($2, source_updated_at)
+where id = $1
+`
+
+type MarkPropertyFetchedParams struct {
+	ID              int32
+	SourceUpdatedAt sql.NullTime
+}
+
+func (q *Queries) MarkPropertyFetched(ctx context.Context, arg MarkPropertyFetchedParams) error {
+	_, err := q.db.ExecContext(ctx, markPropertyFetched, arg.ID, arg.SourceUpdatedAt)
+	return err
+}
+
+const pruneProxyEvents = `-- name: PruneProxyEvents :execrows
+delete from proxy_events where occurred_at < $1
+`
+
+func (q *Queries) PruneProxyEvents(ctx context.Context, occurredAt time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, pruneProxyEvents, occurredAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const reenableProxy = `-- name: ReenableProxy :exec
+update proxies
+set failures        = 0,
+    cooldown_until  = null,
+    last_checked_at = now(),
+    latency_ms      = $2,
+    last_error      = null
+where ip = $1
+`
+
+type ReenableProxyParams struct {
+	Ip        string
+	LatencyMs sql.NullInt32
+}
+
+func (q *Queries) ReenableProxy(ctx context.Context, arg ReenableProxyParams) error {
+	_, err := q.db.ExecContext(ctx, reenableProxy, arg.Ip, arg.LatencyMs)
+	return err
+}
+
+const releasePendingURL = `-- name: ReleasePendingURL :exec
+update pending_urls set claimed_at = null where url = $1
+`
+
+func (q *Queries) ReleasePendingURL(ctx context.Context, url string) error {
+	_, err := q.db.ExecContext(ctx, releasePendingURL, url)
+	return err
+}
+
+const removePendingURL = `-- name: RemovePendingURL :exec
+Delete from pending_urls where url = $1
+`
+
+func (q *Queries) RemovePendingURL(ctx context.Context, url string) error {
+	_, err := q.db.ExecContext(ctx, removePendingURL, url)
+	return err
+}
+
+const requeueDeadLetter = `-- name: RequeueDeadLetter :execrows
+with moved as (delete from dead_letters where id = $1 returning url, priority)
+insert into pending_urls(url, priority) select url, priority from moved
+on conflict (url) do nothing
+`
+
+func (q *Queries) RequeueDeadLetter(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, requeueDeadLetter, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const requeueDeadLetters = `-- name: RequeueDeadLetters :execrows
+with moved as (delete from dead_letters where last_error ilike $1 returning url, priority)
+insert into pending_urls(url, priority) select url, priority from moved
+on conflict (url) do nothing
+`
+
+func (q *Queries) RequeueDeadLetters(ctx context.Context, lastError string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, requeueDeadLetters, lastError)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const saveProxyStats = `-- name: SaveProxyStats :exec
+update proxies
+set uses              = $2,
+    last_used_at      = coalesce($3, last_used_at),
+    successes         = $4,
+    blocks            = $5,
+    timeouts          = $6,
+    latencies_ms      = $7,
+    median_latency_ms = $8
+where ip = $1
+`
+
+type SaveProxyStatsParams struct {
+	Ip              string
+	Uses            sql.NullInt32
+	LastUsedAt      sql.NullTime
+	Successes       float64
+	Blocks          float64
+	Timeouts        float64
+	LatenciesMs     []int32
+	MedianLatencyMs sql.NullInt32
+}
+
+func (q *Queries) SaveProxyStats(ctx context.Context, arg SaveProxyStatsParams) error {
+	_, err := q.db.ExecContext(ctx, saveProxyStats,
+		arg.Ip,
+		arg.Uses,
+		arg.LastUsedAt,
+		arg.Successes,
+		arg.Blocks,
+		arg.Timeouts,
+		pq.Array(arg.LatenciesMs),
+		arg.MedianLatencyMs,
+	)
+	return err
+}
+
+const summarizeProxyEvents = `-- name: SummarizeProxyEvents :many
+select proxy,
+       count(*) filter (where outcome = 'success')::int                                                  as successes,
+       count(*) filter (where outcome = 'blocked')::int                                                  as blocks,
+       count(*) filter (where outcome = 'timeout')::int                                                  as timeouts,
+       count(*) filter (where outcome = 'neutral')::int                                                  as neutral,
+       count(*) filter (where outcome = 'check_failed')::int                                             as failed_checks,
+       coalesce(percentile_disc(0.5) within group (order by latency_ms) filter (where outcome = 'success'), 0)::int  as median_latency_ms,
+       coalesce(percentile_disc(0.95) within group (order by latency_ms) filter (where outcome = 'success'), 0)::int as p95_latency_ms,
+       max(occurred_at)::timestamptz                                                                     as last_event_at
+from proxy_events
+where occurred_at >= $1
+group by proxy
+order by proxy
+`
+
+type SummarizeProxyEventsRow struct {
+	Proxy           string
+	Successes       int32
+	Blocks          int32
+	Timeouts        int32
+	Neutral         int32
+	FailedChecks    int32
+	MedianLatencyMs int32
+	P95LatencyMs    int32
+	LastEventAt     time.Time
+}
+
+func (q *Queries) SummarizeProxyEvents(ctx context.Context, occurredAt time.Time) ([]SummarizeProxyEventsRow, error) {
+	rows, err := q.db.QueryContext(ctx, summarizeProxyEvents, occurredAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SummarizeProxyEventsRow
+	for rows.Next() {
+		var i SummarizeProxyEventsRow
+		if err := rows.Scan(
+			&i.Proxy,
+			&i.Successes,
+			&i.Blocks,
+			&i.Timeouts,
+			&i.Neutral,
+			&i.FailedChecks,
+			&i.MedianLatencyMs,
+			&i.P95LatencyMs,
+			&i.LastEventAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updatePropertySetAddressParts = `-- name: UpdatePropertySetAddressParts :exec
+Update properties set address_number = $1, address_line_two = $2, street = $3, city = $4, county = $5, state = $6
 where id = $7
 `
 
@@ -904,17 +1915,179 @@ func (q *Queries) UpdatePropertySetAddressParts(ctx context.Context, arg UpdateP
 	return err
 }
 
-const updateProxyLastUsedTime = `-- name: UpdateProxyLastUsedTime :exec
-update proxies set lastused = $1, uses = $2 where ip = $3
+const upsertDeadLetter = `-- name: UpsertDeadLetter :exec
+insert into dead_letters(url, property_id, tax_year, attempts, status, headers, body, body_truncated,
+                         proxy, user_agent, last_error, error_chain, priority)
+values($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,
+       coalesce((select priority from pending_urls where url = $1), 0))
+on conflict (url) do update
+    set property_id    = excluded.property_id,
+        tax_year       = excluded.tax_year,
+        attempts       = dead_letters.attempts + excluded.attempts,
+        status         = excluded.status,
+        headers        = excluded.headers,
+        body           = excluded.body,
+        body_truncated = excluded.body_truncated,
+        proxy          = excluded.proxy,
+        user_agent     = excluded.user_agent,
+        last_error     = excluded.last_error,
+        error_chain    = excluded.error_chain,
+        priority       = excluded.priority,
+        failed_at      = now()
 `
 
-type UpdateProxyLastUsedTimeParams struct {
-	Lastused sql.NullString
-	Uses     sql.NullInt32
-	Ip       string
+type UpsertDeadLetterParams struct {
+	Url           string
+	PropertyID    sql.NullInt32
+	TaxYear       sql.NullInt32
+	Attempts      int32
+	Status        sql.NullInt32
+	Headers       json.RawMessage
+	Body          []byte
+	BodyTruncated bool
+	Proxy         string
+	UserAgent     string
+	LastError     string
+	ErrorChain    json.RawMessage
+}
+
+func (q *Queries) UpsertDeadLetter(ctx context.Context, arg UpsertDeadLetterParams) error {
+	_, err := q.db.ExecContext(ctx, upsertDeadLetter,
+		arg.Url,
+		arg.PropertyID,
+		arg.TaxYear,
+		arg.Attempts,
+		arg.Status,
+		arg.Headers,
+		arg.Body,
+		arg.BodyTruncated,
+		arg.Proxy,
+		arg.UserAgent,
+		arg.LastError,
+		arg.ErrorChain,
+	)
+	return err
+}
+
+const upsertPropertyRecord = `-- name: UpsertPropertyRecord :exec
+insert into properties(id,
+                       zoning,neighborhood_cd,neighborhood,
+                       address, legal_description, geographic_id, exemptions,
+                       ownership_percentage, mapsco_map_id, tax_year, created_at, updated_at)
+values($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11, now(), now())
+on conflict (id) do update
+    set zoning               = excluded.zoning,
+        neighborhood_cd      = excluded.neighborhood_cd,
+        neighborhood         = excluded.neighborhood,
+        address              = excluded.address,
+        legal_description    = excluded.legal_description,
+        geographic_id        = excluded.geographic_id,
+        exemptions           = excluded.exemptions,
+        ownership_percentage = excluded.ownership_percentage,
+        mapsco_map_id        = excluded.mapsco_map_id,
+        tax_year             = excluded.tax_year,
+        updated_at           = now()
+where properties.tax_year <= excluded.tax_year
+   or (properties.tax_year is null and $12::boolean)
+`
+
+type UpsertPropertyRecordParams struct {
+	ID                  int32
+	Zoning              sql.NullString
+	NeighborhoodCd      sql.NullString
+	Neighborhood        sql.NullString
+	Address             sql.NullString
+	LegalDescription    sql.NullString
+	GeographicID        sql.NullString
+	Exemptions          sql.NullString
+	OwnershipPercentage sql.NullString
+	MapscoMapID         sql.NullString
+	TaxYear             sql.NullInt32
+	DefaultYear         bool
+}
+
+func (q *Queries) UpsertPropertyRecord(ctx context.Context, arg UpsertPropertyRecordParams) error {
+	_, err := q.db.ExecContext(ctx, upsertPropertyRecord,
+		arg.ID,
+		arg.Zoning,
+		arg.NeighborhoodCd,
+		arg.Neighborhood,
+		arg.Address,
+		arg.LegalDescription,
+		arg.GeographicID,
+		arg.Exemptions,
+		arg.OwnershipPercentage,
+		arg.MapscoMapID,
+		arg.TaxYear,
+		arg.DefaultYear,
+	)
+	return err
 }
 
-func (q *Queries) UpdateProxyLastUsedTime(ctx context.Context, arg UpdateProxyLastUsedTimeParams) error {
-	_, err := q.db.ExecContext(ctx, updateProxyLastUsedTime, arg.Lastused, arg.Uses, arg.Ip)
+const upsertPropertyTaxYear = `-- name: UpsertPropertyTaxYear :exec
+insert into property_tax_years(property_id, tax_year, zoning, legal_description, exemptions, ownership_percentage)
+values($1,$2,$3,$4,$5,$6)
+on conflict (property_id, tax_year) do update
+    set zoning               = excluded.zoning,
+        legal_description    = excluded.legal_description,
+        exemptions           = excluded.exemptions,
+        ownership_percentage = excluded.ownership_percentage,
+        updated_at           = now()
+`
+
+type UpsertPropertyTaxYearParams struct {
+	PropertyID          int32
+	TaxYear             int32
+	Zoning              sql.NullString
+	LegalDescription    sql.NullString
+	Exemptions          sql.NullString
+	OwnershipPercentage sql.NullString
+}
+
+func (q *Queries) UpsertPropertyTaxYear(ctx context.Context, arg UpsertPropertyTaxYearParams) error {
+	_, err := q.db.ExecContext(ctx, upsertPropertyTaxYear,
+		arg.PropertyID,
+		arg.TaxYear,
+		arg.Zoning,
+		arg.LegalDescription,
+		arg.Exemptions,
+		arg.OwnershipPercentage,
+	)
+	return err
+}
+
+const upsertRollValue = `-- name: UpsertRollValue :exec
+insert into roll_values( year, improvements, land_market, ag_valuation, appraised, homestead_cap, assessed, property_id) values($1,$2,$3,$4,$5,$6,$7,$8)
+on conflict (property_id, year) do update
+    set improvements  = excluded.improvements,
+        land_market   = excluded.land_market,
+        ag_valuation  = excluded.ag_valuation,
+        appraised     = excluded.appraised,
+        homestead_cap = excluded.homestead_cap,
+        assessed      = excluded.assessed
+`
+
+type UpsertRollValueParams struct {
+	Year         sql.NullInt32
+	Improvements sql.NullInt32
+	LandMarket   sql.NullInt32
+	AgValuation  sql.NullInt32
+	Appraised    sql.NullInt32
+	HomesteadCap sql.NullInt32
+	Assessed     sql.NullInt32
+	PropertyID   sql.NullInt32
+}
+
+func (q *Queries) UpsertRollValue(ctx context.Context, arg UpsertRollValueParams) error {
+	_, err := q.db.ExecContext(ctx, upsertRollValue,
+		arg.Year,
+		arg.Improvements,
+		arg.LandMarket,
+		arg.AgValuation,
+		arg.Appraised,
+		arg.HomesteadCap,
+		arg.Assessed,
+		arg.PropertyID,
+	)
 	return err
 }
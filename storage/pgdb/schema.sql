@@ -89,6 +89,56 @@ END;
 ALTER PROCEDURE public.isexistingproperty(INOUT propertyid integer) OWNER TO jc;
 
 
+CREATE FUNCTION public.bump_proxy_pool_version() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+    UPDATE public.proxy_pool_version SET version = version + 1;
+    RETURN NULL;
+END;
+$$;
+
+
+ALTER FUNCTION public.bump_proxy_pool_version() OWNER TO jc;
+
+
+
+
+CREATE TABLE public.dead_letters (
+    id integer NOT NULL,
+    url text NOT NULL,
+    property_id integer,
+    tax_year integer,
+    attempts integer NOT NULL,
+    status integer,
+    headers jsonb DEFAULT '{}'::jsonb NOT NULL,
+    body bytea DEFAULT '\x'::bytea NOT NULL,
+    body_truncated boolean DEFAULT false NOT NULL,
+    proxy text DEFAULT ''::text NOT NULL,
+    user_agent text DEFAULT ''::text NOT NULL,
+    last_error text NOT NULL,
+    error_chain jsonb DEFAULT '[]'::jsonb NOT NULL,
+    failed_at timestamp with time zone DEFAULT now() NOT NULL,
+    priority integer DEFAULT 0 NOT NULL
+);
+
+
+ALTER TABLE public.dead_letters OWNER TO jc;
+
+
+CREATE SEQUENCE public.dead_letters_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.dead_letters_id_seq OWNER TO jc;
+
+
+ALTER SEQUENCE public.dead_letters_id_seq OWNED BY public.dead_letters.id;
 
 
 CREATE TABLE public.improvement_detail (
@@ -129,7 +179,8 @@ CREATE TABLE public.improvements (
     state_code character varying(255),
     living_area double precision DEFAULT 0.0,
     value double precision DEFAULT 0.0,
-    property_id integer
+    property_id integer,
+    tax_year integer
 );
 
 
@@ -162,7 +213,8 @@ CREATE TABLE public.jurisdictions (
     estimated_tax integer,
     property_id integer,
     updated_at timestamp with time zone,
-    created_at timestamp with time zone
+    created_at timestamp with time zone,
+    tax_year integer
 );
 
 
@@ -195,7 +247,8 @@ CREATE TABLE public.land (
     eff_front double precision,
     eff_depth double precision,
     market_value integer,
-    property_id integer
+    property_id integer,
+    tax_year integer
 );
 
 
@@ -222,13 +275,60 @@ CREATE TABLE public.properties (
     county character varying(255),
     state character varying(2),
     created_at timestamp with time zone,
-    updated_at timestamp with time zone
+    updated_at timestamp with time zone,
+    last_fetched_at timestamp with time zone,
+    source_updated_at timestamp with time zone,
+    tax_year integer
 );
 
 
 ALTER TABLE public.properties OWNER TO jc;
 
 
+CREATE TABLE public.property_snapshots (
+    id integer NOT NULL,
+    property_id integer NOT NULL,
+    tax_year integer NOT NULL,
+    content_hash text NOT NULL,
+    record jsonb NOT NULL,
+    valid_from timestamp with time zone DEFAULT now() NOT NULL,
+    valid_to timestamp with time zone
+);
+
+
+ALTER TABLE public.property_snapshots OWNER TO jc;
+
+
+CREATE SEQUENCE public.property_snapshots_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.property_snapshots_id_seq OWNER TO jc;
+
+
+ALTER SEQUENCE public.property_snapshots_id_seq OWNED BY public.property_snapshots.id;
+
+
+CREATE TABLE public.property_tax_years (
+    property_id integer NOT NULL,
+    tax_year integer NOT NULL,
+    zoning character varying(255),
+    legal_description character varying(500),
+    exemptions character varying(255),
+    ownership_percentage numeric,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    updated_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+ALTER TABLE public.property_tax_years OWNER TO jc;
+
+
 CREATE TABLE public.roll_values (
     id integer NOT NULL,
     year integer,
@@ -341,7 +441,11 @@ ALTER TABLE public.owners OWNER TO jc;
 
 
 CREATE TABLE public.pending_urls (
-    url text NOT NULL
+    url text NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    priority integer DEFAULT 0 NOT NULL,
+    sort_key double precision DEFAULT random() NOT NULL,
+    claimed_at timestamp with time zone
 );
 
 
@@ -350,15 +454,66 @@ ALTER TABLE public.pending_urls OWNER TO jc;
 
 CREATE TABLE public.proxies (
     ip text NOT NULL,
-    lastused text,
+    last_used_at timestamp with time zone,
     uses integer,
-    is_bad integer
+    is_bad integer,
+    failures integer DEFAULT 0 NOT NULL,
+    cooldown_until timestamp with time zone,
+    last_checked_at timestamp with time zone,
+    latency_ms integer,
+    last_error text,
+    scheme text DEFAULT 'http'::text NOT NULL,
+    username text,
+    password text,
+    successes double precision DEFAULT 0 NOT NULL,
+    blocks double precision DEFAULT 0 NOT NULL,
+    timeouts double precision DEFAULT 0 NOT NULL,
+    latencies_ms integer[] DEFAULT '{}'::integer[] NOT NULL,
+    median_latency_ms integer
 );
 
 
 ALTER TABLE public.proxies OWNER TO jc;
 
 
+CREATE TABLE public.proxy_pool_version (
+    id boolean DEFAULT true NOT NULL,
+    version bigint DEFAULT 0 NOT NULL,
+    CONSTRAINT proxy_pool_version_id_check CHECK (id)
+);
+
+
+ALTER TABLE public.proxy_pool_version OWNER TO jc;
+
+
+CREATE TABLE public.proxy_events (
+    id bigint NOT NULL,
+    occurred_at timestamp with time zone DEFAULT now() NOT NULL,
+    proxy text NOT NULL,
+    outcome text NOT NULL,
+    status integer,
+    latency_ms integer,
+    url text
+);
+
+
+ALTER TABLE public.proxy_events OWNER TO jc;
+
+
+CREATE SEQUENCE public.proxy_events_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.proxy_events_id_seq OWNER TO jc;
+
+
+ALTER SEQUENCE public.proxy_events_id_seq OWNED BY public.proxy_events.id;
+
+
 CREATE TABLE public.schema_migrations (
     version bigint NOT NULL,
     dirty boolean NOT NULL
@@ -381,9 +536,15 @@ CREATE TABLE public.xref_owners_properties (
 ALTER TABLE public.xref_owners_properties OWNER TO jc;
 
 
+ALTER TABLE ONLY public.dead_letters ALTER COLUMN id SET DEFAULT nextval('public.dead_letters_id_seq'::regclass);
+
+
 ALTER TABLE ONLY public.improvement_detail ALTER COLUMN id SET DEFAULT nextval('public."improvementDetail_id_seq"'::regclass);
 
 
+ALTER TABLE ONLY public.proxy_events ALTER COLUMN id SET DEFAULT nextval('public.proxy_events_id_seq'::regclass);
+
+
 
 ALTER TABLE ONLY public.improvements ALTER COLUMN id SET DEFAULT nextval('public.improvements_id_seq'::regclass);
 
@@ -397,10 +558,19 @@ ALTER TABLE ONLY public.land ALTER COLUMN id SET DEFAULT nextval('public.land_id
 
 
 
+ALTER TABLE ONLY public.property_snapshots ALTER COLUMN id SET DEFAULT nextval('public.property_snapshots_id_seq'::regclass);
+
+
+
 ALTER TABLE ONLY public.roll_values ALTER COLUMN id SET DEFAULT nextval('public."main_rollValues_id_seq"'::regclass);
 
 
 
+ALTER TABLE ONLY public.dead_letters
+    ADD CONSTRAINT dead_letters_pk PRIMARY KEY (id);
+
+
+
 ALTER TABLE ONLY public.improvement_detail
     ADD CONSTRAINT improvementdetail_pk PRIMARY KEY (id);
 
@@ -441,11 +611,31 @@ ALTER TABLE ONLY public.properties
 
 
 
+ALTER TABLE ONLY public.property_snapshots
+    ADD CONSTRAINT property_snapshots_pk PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY public.property_tax_years
+    ADD CONSTRAINT property_tax_years_pk PRIMARY KEY (property_id, tax_year);
+
+
+
 ALTER TABLE ONLY public.proxies
     ADD CONSTRAINT proxies_pk PRIMARY KEY (ip);
 
 
 
+ALTER TABLE ONLY public.proxy_events
+    ADD CONSTRAINT proxy_events_pkey PRIMARY KEY (id);
+
+
+
+ALTER TABLE ONLY public.proxy_pool_version
+    ADD CONSTRAINT proxy_pool_version_pkey PRIMARY KEY (id);
+
+
+
 ALTER TABLE ONLY public.schema_migrations
     ADD CONSTRAINT schema_migrations_pkey PRIMARY KEY (version);
 
@@ -456,6 +646,22 @@ ALTER TABLE ONLY public.xref_owners_properties
 
 
 
+CREATE INDEX dead_letters_failed_at_index ON public.dead_letters USING btree (failed_at);
+
+
+
+CREATE UNIQUE INDEX dead_letters_url_index ON public.dead_letters USING btree (url);
+
+
+
+CREATE INDEX proxy_events_occurred_at_index ON public.proxy_events USING btree (occurred_at);
+
+
+
+CREATE INDEX proxy_events_proxy_occurred_at_index ON public.proxy_events USING btree (proxy, occurred_at DESC);
+
+
+
 CREATE INDEX improvement_detail_improvement_id_index ON public.improvement_detail USING btree (improvement_id);
 
 
@@ -476,18 +682,46 @@ CREATE INDEX improvements_property_id_index ON public.improvements USING btree (
 
 
 
+CREATE INDEX improvements_property_id_tax_year_index ON public.improvements USING btree (property_id, tax_year);
+
+
+
 CREATE INDEX jurisdictions_property_id_index ON public.jurisdictions USING btree (property_id);
 
 
 
+CREATE INDEX jurisdictions_property_id_tax_year_index ON public.jurisdictions USING btree (property_id, tax_year);
+
+
+
 CREATE INDEX land_property_id_index ON public.land USING btree (property_id);
 
 
 
+CREATE INDEX land_property_id_tax_year_index ON public.land USING btree (property_id, tax_year);
+
+
+
+CREATE INDEX pending_urls_created_at_index ON public.pending_urls USING btree (created_at);
+
+
+
+CREATE INDEX pending_urls_priority_index ON public.pending_urls USING btree (priority DESC, created_at);
+
+
+
+CREATE INDEX pending_urls_sort_key_index ON public.pending_urls USING btree (sort_key);
+
+
+
 CREATE INDEX properties_city_index ON public.properties USING btree (city);
 
 
 
+CREATE INDEX properties_last_fetched_at_index ON public.properties USING btree (last_fetched_at NULLS FIRST);
+
+
+
 CREATE INDEX properties_neighborhood_index ON public.properties USING btree (neighborhood);
 
 
@@ -496,10 +730,22 @@ CREATE INDEX properties_street_index ON public.properties USING btree (street);
 
 
 
+CREATE UNIQUE INDEX property_snapshots_current_index ON public.property_snapshots USING btree (property_id, tax_year) WHERE (valid_to IS NULL);
+
+
+
+CREATE INDEX property_snapshots_property_id_valid_from_index ON public.property_snapshots USING btree (property_id, tax_year, valid_from);
+
+
+
 CREATE INDEX roll_values_property_id_index ON public.roll_values USING btree (property_id);
 
 
 
+CREATE UNIQUE INDEX roll_values_property_id_year_index ON public.roll_values USING btree (property_id, year);
+
+
+
 ALTER TABLE ONLY public.improvement_detail
     ADD CONSTRAINT improvement_detail_improvement_id_fkey FOREIGN KEY (improvement_id) REFERENCES public.improvements(id) NOT VALID;
 
@@ -521,7 +767,11 @@ ALTER TABLE ONLY public.land
 
 
 ALTER TABLE ONLY public.roll_values
-    ADD CONSTRAINT roll_values_property_id_fkey FOREIGN KEY (property_id) REFERENCES public.roll_values(id) NOT VALID;
+    ADD CONSTRAINT roll_values_property_id_fkey FOREIGN KEY (property_id) REFERENCES public.properties(id) NOT VALID;
+
+
 
+CREATE TRIGGER proxies_pool_changed AFTER INSERT OR DELETE ON public.proxies FOR EACH STATEMENT EXECUTE FUNCTION public.bump_proxy_pool_version();
 
 
+CREATE TRIGGER proxies_pool_updated AFTER UPDATE OF ip, scheme, username, password, is_bad, failures ON public.proxies FOR EACH ROW WHEN (((old.ip)::text IS DISTINCT FROM (new.ip)::text) OR (old.scheme IS DISTINCT FROM new.scheme) OR (old.username IS DISTINCT FROM new.username) OR (old.password IS DISTINCT FROM new.password) OR (old.is_bad IS DISTINCT FROM new.is_bad) OR (old.failures IS DISTINCT FROM new.failures)) EXECUTE FUNCTION public.bump_proxy_pool_version();
@@ -0,0 +1,28 @@
+// Package storage holds what the commands share for reaching the database.
+package storage
+
+import (
+	"database/sql"
+	"flag"
+	"os"
+
+	_ "github.com/lib/pq"
+)
+
+// DSNEnv names the environment variable read for the database connection
+// string when -dsn is not given.
+const DSNEnv = "TAXCOLLECTOR_DSN"
+
+// DSNFlag defines a -dsn flag on fs, defaulting to $TAXCOLLECTOR_DSN. The
+// connection string is anything lib/pq accepts, a postgres:// url or
+// key=value pairs; left empty, lib/pq falls back to the PGHOST, PGUSER and
+// other standard Postgres variables.
+func DSNFlag(fs *flag.FlagSet) *string {
+	return fs.String("dsn", os.Getenv(DSNEnv), "postgres connection string (default $"+DSNEnv+")")
+}
+
+// Open returns a handle on the Postgres database at dsn. Like sql.Open it
+// does not connect until the handle is first used.
+func Open(dsn string) (*sql.DB, error) {
+	return sql.Open("postgres", dsn)
+}
@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestDSNFlag(t *testing.T) {
+	t.Setenv(DSNEnv, "postgres://env/tax")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	dsn := DSNFlag(fs)
+	if err := fs.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	if *dsn != "postgres://env/tax" {
+		t.Errorf("without -dsn got %q, want the environment's", *dsn)
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	dsn = DSNFlag(fs)
+	if err := fs.Parse([]string{"-dsn", "postgres://flag/tax"}); err != nil {
+		t.Fatal(err)
+	}
+	if *dsn != "postgres://flag/tax" {
+		t.Errorf("with -dsn got %q, want the flag's", *dsn)
+	}
+}
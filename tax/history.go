@@ -0,0 +1,88 @@
+package tax
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Hash is a stable digest of the record's content, used to tell whether a
+// re-scraped property differs from the snapshot we already hold.
+func (pr PropertyRecord) Hash() (string, []byte, error) {
+	b, err := json.Marshal(pr)
+	if err != nil {
+		return "", nil, err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), b, nil
+}
+
+type Change struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// Diff lists the fields that differ between two records, keyed by their json
+// path (e.g. "land[0].acres"). A field present on only one side has an empty
+// value on the other.
+func Diff(old, new PropertyRecord) ([]Change, error) {
+	a, err := flatten(old)
+	if err != nil {
+		return nil, err
+	}
+	b, err := flatten(new)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	for k, v := range a {
+		if b[k] != v {
+			changes = append(changes, Change{Field: k, Old: v, New: b[k]})
+		}
+	}
+	for k, v := range b {
+		if _, ok := a[k]; !ok {
+			changes = append(changes, Change{Field: k, New: v})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes, nil
+}
+
+func flatten(pr PropertyRecord) (map[string]string, error) {
+	b, err := json.Marshal(pr)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	out := make(map[string]string)
+	flattenValue("", v, out)
+	return out, nil
+}
+
+func flattenValue(path string, v interface{}, out map[string]string) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, c := range t {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			flattenValue(p, c, out)
+		}
+	case []interface{}:
+		for i, c := range t {
+			flattenValue(fmt.Sprintf("%s[%d]", path, i), c, out)
+		}
+	case nil:
+	default:
+		out[path] = fmt.Sprint(t)
+	}
+}
@@ -0,0 +1,63 @@
+package tax
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func Test_Diff(t *testing.T) {
+	d, err := ioutil.ReadFile("../test_data/2163.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(d)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := GetPropertyRecord(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(old.Land) == 0 {
+		t.Fatal("fixture has no land rows")
+	}
+
+	changes, err := Diff(old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("Diff of identical records = %v, want none", changes)
+	}
+
+	updated := old
+	updated.Land = append([]Land(nil), old.Land...)
+	updated.Zoning = "R-2"
+	updated.Land[0].Acres = "9.99"
+
+	oldHash, _, _ := old.Hash()
+	newHash, _, _ := updated.Hash()
+	if oldHash == newHash {
+		t.Fatal("Hash did not change with content")
+	}
+
+	changes, err = Diff(old, updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Change{
+		{Field: "land[0].acres", Old: old.Land[0].Acres, New: "9.99"},
+		{Field: "zoning", Old: old.Zoning, New: "R-2"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("Diff = %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("change %d = %v, want %v", i, changes[i], want[i])
+		}
+	}
+}
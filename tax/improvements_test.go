@@ -11,7 +11,7 @@ import (
 
 func Test_getImprovements(t *testing.T) {
 
-	d, err := ioutil.ReadFile("test_data/2163.html")
+	d, err := ioutil.ReadFile("../test_data/2163.html")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -29,7 +29,7 @@ func Test_getImprovements(t *testing.T) {
 	}
 }
 func Test_GetDetails(t *testing.T) {
-	d, err := ioutil.ReadFile("test_data/2163.html")
+	d, err := ioutil.ReadFile("../test_data/2163.html")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -3,7 +3,9 @@ package tax
 import (
 	"database/sql"
 	"fmt"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 
@@ -12,6 +14,7 @@ import (
 
 type PropertyRecord struct {
 	PropertyID          string               `json:"propertyID"`
+	TaxYear             string               `json:"taxYear"`
 	OwnerID             string               `json:"ownerID"`
 	OwnerName           string               `json:"ownerName"`
 	OwnerMailingAddress string               `json:"ownerMailingAddress"`
@@ -28,6 +31,11 @@ type PropertyRecord struct {
 	Land                []Land               `json:"land"`
 	Improvements        []Improvement        `json:"improvements"`
 	Jurisdictions       []TaxingJurisdiction `json:"jurisdictions"`
+
+	// SourceUpdatedAt is the "Database last updated on" date from the page
+	// footer. It says nothing about the property itself, so it is left out of
+	// the record's json and hash.
+	SourceUpdatedAt time.Time `json:"-"`
 }
 
 type PropertyDetailItem struct {
@@ -59,15 +67,33 @@ func GetPropertyRecord(doc *goquery.Document) (PropertyRecord, error) {
 	propertyRecord.OwnerName = itemMap["ownerName"].Value
 	propertyRecord.OwnerMailingAddress = itemMap["ownerMailingAddress"].Value
 	propertyRecord.Zoning = itemMap["zoning"].Value
+	propertyRecord.TaxYear = strings.TrimSpace(doc.Find("#propertyHeading_taxyear option[selected]").First().AttrOr("value", ""))
 
 	propertyRecord.Improvements = getImprovements(doc)
 	propertyRecord.Land = getLandInfo(doc)
 	propertyRecord.Jurisdictions = getTaxingJurisdictions(doc)
 	propertyRecord.RollValue = getRollValue(doc)
+	propertyRecord.SourceUpdatedAt = SourceUpdatedAt(doc)
 
 	return propertyRecord, nil
 }
 
+var sourceUpdatedRe = regexp.MustCompile(`Database last updated on:\s*(\d{1,2}/\d{1,2}/\d{4}\s+\d{1,2}:\d{2}\s*[AP]M)`)
+
+// SourceUpdatedAt reads the date the county last refreshed its database
+// from the page footer. It returns the zero time if the footer is missing.
+func SourceUpdatedAt(doc *goquery.Document) time.Time {
+	m := sourceUpdatedRe.FindStringSubmatch(doc.Find("#footer").Text())
+	if m == nil {
+		return time.Time{}
+	}
+	t, err := time.ParseInLocation("1/2/2006 3:04 PM", strings.Join(strings.Fields(m[1]), " "), time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
 func loadPropertyDetailItems() map[string]PropertyDetailItem {
 	detailItemMap := make(map[string]PropertyDetailItem)
 	detailItemMap["propertyID"] = PropertyDetailItem{
@@ -0,0 +1,34 @@
+package tax
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestSourceUpdatedAt(t *testing.T) {
+	d, err := ioutil.ReadFile("../test_data/2163.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(d)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := time.Date(2022, 4, 30, 22, 46, 0, 0, time.Local)
+	if got := SourceUpdatedAt(doc); !got.Equal(want) {
+		t.Errorf("SourceUpdatedAt() = %s, want %s", got, want)
+	}
+
+	empty, err := goquery.NewDocumentFromReader(strings.NewReader("<html></html>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := SourceUpdatedAt(empty); !got.IsZero() {
+		t.Errorf("SourceUpdatedAt() on a page without a footer = %s, want zero", got)
+	}
+}
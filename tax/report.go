@@ -0,0 +1,55 @@
+package tax
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ParseReport summarises how much of a detail page the parser picked up, so a
+// record with blank fields or missing tables stands out without diffing it
+// against the page.
+type ParseReport struct {
+	TaxYear         string   `json:"taxYear"`
+	SourceUpdatedAt string   `json:"sourceUpdatedAt,omitempty"`
+	Missing         []string `json:"missing,omitempty"`
+	Improvements    int      `json:"improvements"`
+	Land            int      `json:"land"`
+	Jurisdictions   int      `json:"jurisdictions"`
+	RollValues      int      `json:"rollValues"`
+}
+
+func (pr PropertyRecord) Report() ParseReport {
+	r := ParseReport{
+		TaxYear:       pr.TaxYear,
+		Missing:       emptyFields(pr),
+		Improvements:  len(pr.Improvements),
+		Land:          len(pr.Land),
+		Jurisdictions: len(pr.Jurisdictions),
+		RollValues:    len(pr.RollValue),
+	}
+	if !pr.SourceUpdatedAt.IsZero() {
+		r.SourceUpdatedAt = pr.SourceUpdatedAt.Format(time.RFC3339)
+	}
+	return r
+}
+
+// emptyFields lists the json names of the record's string fields that the
+// parser left blank.
+func emptyFields(pr PropertyRecord) []string {
+	var missing []string
+	v := reflect.ValueOf(pr)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Type.Kind() != reflect.String || v.Field(i).String() != "" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			name = f.Name
+		}
+		missing = append(missing, name)
+	}
+	return missing
+}
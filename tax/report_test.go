@@ -0,0 +1,20 @@
+package tax
+
+import "testing"
+
+func Test_Report(t *testing.T) {
+	pr := PropertyRecord{PropertyID: "2163", TaxYear: "2022", Land: []Land{{}}}
+
+	r := pr.Report()
+	if r.TaxYear != "2022" || r.Land != 1 || r.Improvements != 0 {
+		t.Errorf("Report() = %+v", r)
+	}
+	for _, f := range r.Missing {
+		if f == "propertyID" || f == "taxYear" {
+			t.Errorf("Report().Missing lists %s, which is set", f)
+		}
+	}
+	if len(r.Missing) == 0 || r.Missing[0] != "ownerID" {
+		t.Errorf("Report().Missing = %v, want it to start with ownerID", r.Missing)
+	}
+}
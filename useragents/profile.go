@@ -0,0 +1,168 @@
+package useragents
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Profile is the set of headers one browser sends, built to agree with its
+// user agent: a Chrome user agent gets Chrome's Accept and client hints for
+// the same version and platform, a Firefox one gets none, and so on. The
+// browser's header order is not part of a profile, since net/http writes
+// headers in an order of its own.
+type Profile struct {
+	UserAgent string
+	Browser   string
+	Platform  string
+	// Headers are sent on every request.
+	Headers http.Header
+}
+
+var (
+	chromeVersion  = regexp.MustCompile(`Chrome/(\d+)`)
+	firefoxVersion = regexp.MustCompile(`Firefox/(\d+)`)
+)
+
+// NewProfile builds the profile for a user agent string. User agents it does
+// not recognise get a plain set of headers any browser would send.
+func NewProfile(ua string) Profile {
+	p := Profile{UserAgent: ua, Platform: platform(ua)}
+	mobile := strings.Contains(ua, "Mobile")
+
+	switch {
+	case strings.Contains(ua, "Edg/") && chromeVersion.MatchString(ua):
+		p.Browser = "edge"
+		p.Headers = chromiumHeaders(ua, "Microsoft Edge", chromeVersion.FindStringSubmatch(ua)[1], p.Platform, mobile)
+	case strings.Contains(ua, "Chrome/") && !strings.Contains(ua, "OPR/"):
+		p.Browser = "chrome"
+		p.Headers = chromiumHeaders(ua, "Google Chrome", chromeVersion.FindStringSubmatch(ua)[1], p.Platform, mobile)
+	case firefoxVersion.MatchString(ua):
+		p.Browser = "firefox"
+		p.Headers = headers(
+			"User-Agent", ua,
+			"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
+			"Accept-Language", "en-US,en;q=0.5",
+			"Accept-Encoding", "gzip, deflate, br",
+			"Upgrade-Insecure-Requests", "1",
+			"Sec-Fetch-Dest", "document",
+			"Sec-Fetch-Mode", "navigate",
+			"Sec-Fetch-Site", "none",
+			"Sec-Fetch-User", "?1",
+		)
+	case strings.Contains(ua, "Safari/") && strings.Contains(ua, "Version/"):
+		p.Browser = "safari"
+		p.Headers = headers(
+			"Sec-Fetch-Dest", "document",
+			"User-Agent", ua,
+			"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			"Sec-Fetch-Site", "none",
+			"Sec-Fetch-Mode", "navigate",
+			"Accept-Language", "en-US,en;q=0.9",
+			"Accept-Encoding", "gzip, deflate, br",
+		)
+	default:
+		p.Browser = "other"
+		p.Headers = headers(
+			"User-Agent", ua,
+			"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			"Accept-Language", "en-US,en;q=0.9",
+			"Accept-Encoding", "gzip, deflate, br",
+		)
+	}
+	return p
+}
+
+func chromiumHeaders(ua, brand, version, platform string, mobile bool) http.Header {
+	chMobile := "?0"
+	if mobile {
+		chMobile = "?1"
+	}
+	return headers(
+		"sec-ch-ua", fmt.Sprintf(`"Not_A Brand";v="8", "Chromium";v="%s", "%s";v="%s"`, version, brand, version),
+		"sec-ch-ua-mobile", chMobile,
+		"sec-ch-ua-platform", fmt.Sprintf("%q", platform),
+		"Upgrade-Insecure-Requests", "1",
+		"User-Agent", ua,
+		"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7",
+		"Sec-Fetch-Site", "none",
+		"Sec-Fetch-Mode", "navigate",
+		"Sec-Fetch-User", "?1",
+		"Sec-Fetch-Dest", "document",
+		"Accept-Encoding", "gzip, deflate, br",
+		"Accept-Language", "en-US,en;q=0.9",
+	)
+}
+
+// headers builds a header from name, value pairs.
+func headers(kv ...string) http.Header {
+	h := make(http.Header, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		h.Set(kv[i], kv[i+1])
+	}
+	return h
+}
+
+// platform is the platform as Chromium reports it in sec-ch-ua-platform.
+func platform(ua string) string {
+	switch {
+	case strings.Contains(ua, "Windows"):
+		return "Windows"
+	case strings.Contains(ua, "Android"):
+		return "Android"
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"):
+		return "iOS"
+	case strings.Contains(ua, "Macintosh"), strings.Contains(ua, "Mac OS X"):
+		return "macOS"
+	case strings.Contains(ua, "CrOS"):
+		return "Chrome OS"
+	case strings.Contains(ua, "Linux"):
+		return "Linux"
+	default:
+		return "Unknown"
+	}
+}
+
+// Apply sets the profile's headers on req as a navigation from referer, or as
+// the first page of a visit when referer is empty. Headers the caller has
+// already set, like a form's Content-Type, are left alone except where the
+// profile has its own value.
+//
+// A GET is taken to be a link the user followed. A POST is taken to be an
+// ASP.NET postback, a form submitted by script rather than by a submit button,
+// which browsers send with an Origin but without Sec-Fetch-User; Chromium
+// also asks for a fresh copy with Cache-Control.
+func (p Profile) Apply(req *http.Request, referer string) {
+	for name, values := range p.Headers {
+		req.Header[name] = append([]string(nil), values...)
+	}
+	if referer == "" {
+		return
+	}
+
+	if req.Header.Get("Referer") == "" {
+		req.Header.Set("Referer", referer)
+	}
+	if req.Header.Get("Sec-Fetch-Site") != "" {
+		req.Header.Set("Sec-Fetch-Site", fetchSite(req.URL, referer))
+	}
+	if req.Method == http.MethodPost {
+		req.Header.Set("Origin", req.URL.Scheme+"://"+req.URL.Host)
+		req.Header.Del("Sec-Fetch-User")
+		if p.Browser == "chrome" || p.Browser == "edge" {
+			req.Header.Set("Cache-Control", "max-age=0")
+		}
+	}
+}
+
+// fetchSite is Sec-Fetch-Site for a navigation to target from referer. Sites
+// are not told apart from origins, so any other origin is cross-site.
+func fetchSite(target *url.URL, referer string) string {
+	r, err := url.Parse(referer)
+	if err != nil || !strings.EqualFold(r.Scheme, target.Scheme) || !strings.EqualFold(r.Host, target.Host) {
+		return "cross-site"
+	}
+	return "same-origin"
+}
@@ -0,0 +1,97 @@
+package useragents
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestNewProfile(t *testing.T) {
+	tests := []struct {
+		ua       string
+		browser  string
+		platform string
+		chUA     string
+	}{
+		{
+			ua:       "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			browser:  "chrome",
+			platform: "Windows",
+			chUA:     `"Not_A Brand";v="8", "Chromium";v="120", "Google Chrome";v="120"`,
+		},
+		{
+			ua:       "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36 Edg/119.0.2151.97",
+			browser:  "edge",
+			platform: "macOS",
+			chUA:     `"Not_A Brand";v="8", "Chromium";v="119", "Microsoft Edge";v="119"`,
+		},
+		{
+			ua:       "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+			browser:  "firefox",
+			platform: "Linux",
+		},
+		{
+			ua:       "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/15.1 Safari/605.1.15",
+			browser:  "safari",
+			platform: "macOS",
+		},
+	}
+	for _, tt := range tests {
+		p := NewProfile(tt.ua)
+		if p.Browser != tt.browser || p.Platform != tt.platform {
+			t.Errorf("NewProfile(%q) is %s on %s, want %s on %s", tt.ua, p.Browser, p.Platform, tt.browser, tt.platform)
+		}
+
+		req, _ := http.NewRequest("GET", "https://example.com/", nil)
+		p.Apply(req, "")
+		if got := req.Header.Get("User-Agent"); got != tt.ua {
+			t.Errorf("%s profile sends User-Agent %q", tt.browser, got)
+		}
+		if got := req.Header.Get("sec-ch-ua"); got != tt.chUA {
+			t.Errorf("%s profile sends sec-ch-ua %q, want %q", tt.browser, got, tt.chUA)
+		}
+	}
+}
+
+func TestProfile_Apply(t *testing.T) {
+	p := NewProfile("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+
+	req, _ := http.NewRequest("GET", "https://example.com/clientdb/?cid=56", nil)
+	p.Apply(req, "")
+	if req.Header.Get("Sec-Fetch-Site") != "none" || req.Header.Get("Referer") != "" {
+		t.Errorf("first navigation headers: %v", req.Header)
+	}
+
+	post, _ := http.NewRequest("POST", "https://example.com/clientdb/Property.aspx", nil)
+	post.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	p.Apply(post, "https://example.com/clientdb/?cid=56")
+	want := map[string]string{
+		"Sec-Fetch-Site": "same-origin",
+		"Referer":        "https://example.com/clientdb/?cid=56",
+		"Origin":         "https://example.com",
+		"Content-Type":   "application/x-www-form-urlencoded",
+	}
+	for name, v := range want {
+		if got := post.Header.Get(name); got != v {
+			t.Errorf("postback %s = %q, want %q", name, got, v)
+		}
+	}
+	if got := post.Header.Get("Sec-Fetch-User"); got != "" {
+		t.Errorf("script-submitted postback sent Sec-Fetch-User %q", got)
+	}
+	if got := post.Header.Get("Cache-Control"); got != "max-age=0" {
+		t.Errorf("Chrome postback sent Cache-Control %q, want max-age=0", got)
+	}
+
+	link, _ := http.NewRequest("GET", "https://example.com/clientdb/Property.aspx?prop_id=1", nil)
+	p.Apply(link, "https://example.com/clientdb/SearchResults.aspx")
+	if link.Header.Get("Sec-Fetch-User") != "?1" || link.Header.Get("Sec-Fetch-Site") != "same-origin" {
+		t.Errorf("followed link sent Sec-Fetch-User %q, Sec-Fetch-Site %q", link.Header.Get("Sec-Fetch-User"), link.Header.Get("Sec-Fetch-Site"))
+	}
+
+	ff := NewProfile("Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0")
+	ffPost, _ := http.NewRequest("POST", "https://example.com/clientdb/Property.aspx", nil)
+	ff.Apply(ffPost, "https://other.example/")
+	if ffPost.Header.Get("Cache-Control") != "" || ffPost.Header.Get("Sec-Fetch-Site") != "cross-site" {
+		t.Errorf("Firefox postback from another site sent Cache-Control %q, Sec-Fetch-Site %q", ffPost.Header.Get("Cache-Control"), ffPost.Header.Get("Sec-Fetch-Site"))
+	}
+}
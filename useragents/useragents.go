@@ -2,18 +2,54 @@ package useragents
 
 import (
 	"bufio"
+	_ "embed"
 	"errors"
+	"fmt"
+	"io"
+	"math"
 	"math/rand"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
+// defaultList is the catalogue used until another is loaded.
+//
+//go:embed default.txt
+var defaultList string
+
+// Agent is a user agent and its share of the traffic it is picked for.
+type Agent struct {
+	UserAgent string
+	Share     float64
+}
+
+// UserAgentClient picks user agents at random in proportion to their shares.
+// It is safe for concurrent use, and the zero value picks from the embedded
+// default catalogue.
 type UserAgentClient struct {
-	agentList []string
+	mu        sync.Mutex
+	agentList []Agent
+	// cumulative[i] is the total share of agentList[:i+1].
+	cumulative []float64
+	random     *rand.Rand
+}
+
+// NewUserAgentClient returns a client picking from agents, or from the
+// embedded default catalogue when agents is empty.
+func NewUserAgentClient(agents []Agent) *UserAgentClient {
+	u := &UserAgentClient{}
+	u.setAgents(agents)
+	return u
 }
 
+// LoadUserAgents replaces the catalogue with the one in the file at fp. The
+// whole file is checked first, and the catalogue is left alone if any line
+// is invalid.
 func (u *UserAgentClient) LoadUserAgents(fp string) error {
-	var err error
 	if fp == "" {
 		return errors.New("no filename provided")
 	}
@@ -23,23 +59,147 @@ func (u *UserAgentClient) LoadUserAgents(fp string) error {
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		u.agentList = append(u.agentList, scanner.Text())
+	agents, err := ParseUserAgents(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fp, err)
 	}
-	return scanner.Err()
+	u.setAgents(agents)
+	return nil
+}
 
+// Agents returns the catalogue being picked from.
+func (u *UserAgentClient) Agents() []Agent {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.init()
+	return append([]Agent(nil), u.agentList...)
 }
 
 func (u *UserAgentClient) GetRandomUserAgent() (string, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.init()
+
+	r := u.random.Float64() * u.cumulative[len(u.cumulative)-1]
+	i := sort.Search(len(u.cumulative), func(i int) bool { return u.cumulative[i] > r })
+	if i == len(u.agentList) {
+		i--
+	}
+	return u.agentList[i].UserAgent, nil
+}
+
+func (u *UserAgentClient) setAgents(agents []Agent) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.setAgentsLocked(agents)
+}
+
+func (u *UserAgentClient) setAgentsLocked(agents []Agent) {
+	if len(agents) == 0 {
+		agents = defaultAgents()
+	}
+	u.agentList = append([]Agent(nil), agents...)
+	u.cumulative = make([]float64, len(agents))
+	var total float64
+	for i, a := range agents {
+		total += a.Share
+		u.cumulative[i] = total
+	}
+	if u.random == nil {
+		u.random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+}
 
-	if u.agentList == nil {
-		return "", errors.New("agent list is nil")
+// init fills in a zero UserAgentClient. u.mu must be held.
+func (u *UserAgentClient) init() {
+	if u.random == nil {
+		u.setAgentsLocked(nil)
 	}
-	rand.Seed(time.Now().UnixNano())
+}
+
+func defaultAgents() []Agent {
+	agents, err := ParseUserAgents(strings.NewReader(defaultList))
+	if err != nil {
+		panic("useragents: default catalogue: " + err.Error())
+	}
+	return agents
+}
 
-	i := rand.Intn(len(u.agentList)-0) + 0
+// ParseUserAgents reads a catalogue of user agents, one to a line. A line may
+// end in a tab and the user agent's share of traffic, which is relative to
+// the others' and is 1 when left out. Blank lines and lines starting with #
+// are skipped.
+func ParseUserAgents(r io.Reader) ([]Agent, error) {
+	var agents []Agent
+	seen := make(map[string]int)
 
-	return u.agentList[i], nil
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
 
+		a := Agent{UserAgent: line, Share: 1}
+		if i := strings.LastIndexByte(line, '\t'); i >= 0 {
+			share, err := strconv.ParseFloat(strings.TrimSpace(line[i+1:]), 64)
+			if err != nil || share <= 0 || math.IsInf(share, 0) {
+				return nil, fmt.Errorf("line %d: share %q is not a positive number", n, line[i+1:])
+			}
+			a.UserAgent, a.Share = strings.TrimSpace(line[:i]), share
+		}
+		if err := validUserAgent(a.UserAgent); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if first, ok := seen[a.UserAgent]; ok {
+			return nil, fmt.Errorf("line %d: user agent repeats line %d", n, first)
+		}
+		seen[a.UserAgent] = n
+		agents = append(agents, a)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(agents) == 0 {
+		return nil, errors.New("no user agents")
+	}
+	return agents, nil
+}
+
+// validUserAgent checks ua looks like something a browser would send: a
+// Mozilla/5.0 product token followed by a parenthesised platform, printable
+// ascii only, with balanced parentheses.
+func validUserAgent(ua string) error {
+	if !strings.HasPrefix(ua, "Mozilla/5.0 (") {
+		return fmt.Errorf("user agent %q does not start with \"Mozilla/5.0 (\"", ua)
+	}
+	depth := 0
+	for _, c := range ua {
+		if c < ' ' || c > '~' {
+			return fmt.Errorf("user agent %q has character %q", ua, c)
+		}
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth < 0 {
+			break
+		}
+	}
+	if depth != 0 {
+		return fmt.Errorf("user agent %q has unbalanced parentheses", ua)
+	}
+	return nil
+}
+
+// GetRandomProfile returns the browser profile for a random user agent from
+// the list.
+func (u *UserAgentClient) GetRandomProfile() (Profile, error) {
+	ua, err := u.GetRandomUserAgent()
+	if err != nil {
+		return Profile{}, err
+	}
+	return NewProfile(ua), nil
 }
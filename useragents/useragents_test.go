@@ -0,0 +1,86 @@
+package useragents
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	chrome  = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	firefox = "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0"
+)
+
+func TestParseUserAgents(t *testing.T) {
+	agents, err := ParseUserAgents(strings.NewReader("# comment\n\n" + chrome + "\t3\n" + firefox + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Agent{{chrome, 3}, {firefox, 1}}
+	if len(agents) != len(want) || agents[0] != want[0] || agents[1] != want[1] {
+		t.Errorf("ParseUserAgents() = %v, want %v", agents, want)
+	}
+
+	bad := map[string]string{
+		"empty":           "# nothing here\n",
+		"zero share":      chrome + "\t0\n",
+		"bad share":       chrome + "\tlots\n",
+		"not a browser":   "curl/8.4.0\n",
+		"unbalanced":      "Mozilla/5.0 (Windows NT 10.0; Win64\n",
+		"control char":    "Mozilla/5.0 (Windows NT 10.0)\x00\n",
+		"repeated agents": chrome + "\n" + chrome + "\t2\n",
+	}
+	for name, in := range bad {
+		if _, err := ParseUserAgents(strings.NewReader(in)); err == nil {
+			t.Errorf("%s: ParseUserAgents(%q) accepted it", name, in)
+		}
+	}
+}
+
+func TestDefaultCatalogue(t *testing.T) {
+	agents := (&UserAgentClient{}).Agents()
+	if len(agents) == 0 {
+		t.Fatal("zero UserAgentClient has no agents")
+	}
+	for _, a := range agents {
+		if p := NewProfile(a.UserAgent); p.Browser == "other" {
+			t.Errorf("default agent %q has no matching profile", a.UserAgent)
+		}
+	}
+}
+
+func TestUserAgentClient_GetRandomUserAgent(t *testing.T) {
+	u := NewUserAgentClient([]Agent{{chrome, 9}, {firefox, 1}})
+
+	var (
+		mu     sync.Mutex
+		counts = make(map[string]int)
+		wg     sync.WaitGroup
+	)
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 2500; i++ {
+				ua, err := u.GetRandomUserAgent()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				counts[ua]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(counts) != 2 {
+		t.Fatalf("picked %v", counts)
+	}
+	// 9 in 10 picks should be chrome; 8000 is over 10 standard deviations
+	// below the expected 9000.
+	if counts[chrome] < 8000 || counts[firefox] == 0 {
+		t.Errorf("picked %v, want chrome about 9 times as often as firefox", counts)
+	}
+}